@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ANTHROPIC_BASE_URL is used by -provider anthropic without -base-url or ANTHROPIC_BASE_URL
+const ANTHROPIC_BASE_URL = "https://api.anthropic.com/v1"
+
+// ANTHROPIC_VERSION is the Messages API version requested
+const ANTHROPIC_VERSION = "2023-06-01"
+
+// ANTHROPIC_MAX_TOKENS caps an answer; the Messages API requires a limit
+const ANTHROPIC_MAX_TOKENS = 8192
+
+// ErrNoEmbeddings is returned by backends without an embeddings API
+var ErrNoEmbeddings = errors.New("this provider has no embeddings API (use -provider ollama or openai for -embed and -rag)")
+
+// AnthropicProvider talks to the Anthropic Messages API
+type AnthropicProvider struct {
+	BaseURL string
+	APIKey  string
+}
+
+func (p *AnthropicProvider) Name() string { return "Anthropic" }
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicEvent is a whole response or, streamed, one event; only the
+// fields viber reads are decoded
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Usage   *anthropicUsage `json:"usage"`
+	Message *struct {
+		Usage *anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta *struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicConversation moves system messages into the separate system
+// field and merges consecutive turns of the same role, which the API rejects
+func anthropicConversation(messages []api.Message) (string, []anthropicMessage) {
+	var system []string
+	var turns []anthropicMessage
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "system":
+			system = append(system, msg.Content)
+		case len(turns) > 0 && turns[len(turns)-1].Role == msg.Role:
+			turns[len(turns)-1].Content += "\n\n" + msg.Content
+		default:
+			turns = append(turns, anthropicMessage{Role: msg.Role, Content: msg.Content})
+		}
+	}
+	return strings.Join(system, "\n\n"), turns
+}
+
+// Chat runs one /messages request; streamed answers are read as
+// server-sent events
+func (p *AnthropicProvider) Chat(ctx context.Context, model string, messages []api.Message, stream bool, onChunk func(string) error) (Completion, error) {
+	system, turns := anthropicConversation(messages)
+	payload := map[string]any{
+		"model":      model,
+		"max_tokens": ANTHROPIC_MAX_TOKENS,
+		"messages":   turns,
+		"stream":     stream,
+	}
+	if system != "" {
+		payload["system"] = system
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	start := time.Now()
+	body, err := p.do(ctx, http.MethodPost, "/messages", data)
+	if err != nil {
+		return Completion{}, err
+	}
+	defer body.Close()
+
+	var result Completion
+	addUsage := func(usage *anthropicUsage) {
+		if usage != nil {
+			result.PromptTokens = max(result.PromptTokens, usage.InputTokens)
+			result.CompletionTokens = max(result.CompletionTokens, usage.OutputTokens)
+		}
+	}
+	if !stream {
+		var res anthropicEvent
+		if err := json.NewDecoder(body).Decode(&res); err != nil {
+			return Completion{}, fmt.Errorf("decoding the response: %w", err)
+		}
+		var answer strings.Builder
+		for _, block := range res.Content {
+			if block.Type == "text" {
+				answer.WriteString(block.Text)
+			}
+		}
+		result.Answer = answer.String()
+		addUsage(res.Usage)
+		result.Duration = time.Since(start)
+		return result, nil
+	}
+
+	var fullResponse strings.Builder
+	err = readEvents(ctx, body, func(data string) error {
+		var event anthropicEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("decoding a stream event: %w", err)
+		}
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				addUsage(event.Message.Usage)
+			}
+		case "message_delta":
+			addUsage(event.Usage)
+		case "message_stop":
+			return io.EOF
+		case "error":
+			if event.Error != nil {
+				return fmt.Errorf("stream error: %s", event.Error.Message)
+			}
+			return fmt.Errorf("stream error")
+		case "content_block_delta":
+			if event.Delta == nil || event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+				return nil
+			}
+			fullResponse.WriteString(event.Delta.Text)
+			if onChunk != nil {
+				return onChunk(event.Delta.Text)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Completion{}, err
+	}
+	result.Answer = fullResponse.String()
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// Embed always fails: Anthropic has no embeddings endpoint
+func (p *AnthropicProvider) Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	return nil, ErrNoEmbeddings
+}
+
+// Models lists the ids returned by /models
+func (p *AnthropicProvider) Models(ctx context.Context) ([]string, error) {
+	body, err := p.do(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return decodeModelIDs(body)
+}
+
+func (p *AnthropicProvider) do(ctx context.Context, method string, path string, payload []byte) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", p.APIKey)
+	req.Header.Set("Anthropic-Version", ANTHROPIC_VERSION)
+	return sendHTTP(req)
+}
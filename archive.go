@@ -0,0 +1,183 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ARCHIVE_SEP separates the archive path from the entry name, as in
+// vendor/deps.zip!lib/util.go
+const ARCHIVE_SEP = "!"
+
+var archiveSuffixes = []string{".zip", ".tar.gz", ".tgz"}
+
+func isArchive(p string) bool {
+	lower := strings.ToLower(p)
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitArchivePath splits "archive!entry" into its parts. Only a separator
+// right after an archive suffix counts, so "!" elsewhere in a path is safe.
+func splitArchivePath(p string) (string, string, bool) {
+	lower := strings.ToLower(p)
+	for _, suffix := range archiveSuffixes {
+		if i := strings.Index(lower, suffix+ARCHIVE_SEP); i >= 0 {
+			cut := i + len(suffix)
+			return p[:cut], p[cut+len(ARCHIVE_SEP):], true
+		}
+	}
+	return "", "", false
+}
+
+type archiveEntry struct {
+	Name    string
+	Content string
+}
+
+// readArchive returns the regular files of a .zip or .tar.gz archive, read
+// in memory. Entries over MAX_SANE_FILE_SIZE are left out.
+func readArchive(p string) ([]archiveEntry, error) {
+	if strings.HasSuffix(strings.ToLower(p), ".zip") {
+		return readZip(p)
+	}
+	return readTarGz(p)
+}
+
+func readZip(p string) ([]archiveEntry, error) {
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var entries []archiveEntry
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || f.UncompressedSize64 > MAX_SANE_FILE_SIZE {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, MAX_SANE_FILE_SIZE))
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, archiveEntry{Name: f.Name, Content: string(data)})
+	}
+	return entries, nil
+}
+
+func readTarGz(p string) ([]archiveEntry, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var entries []archiveEntry
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return entries, err
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Size > MAX_SANE_FILE_SIZE {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, MAX_SANE_FILE_SIZE))
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, archiveEntry{Name: hdr.Name, Content: string(data)})
+	}
+	return entries, nil
+}
+
+// archiveEntries reads an archive, applies the extension, ignore and empty
+// file filters to its entries and returns the "archive!entry" paths that
+// pass. Contents are cached so the workers don't reopen the archive.
+func (s *FileScanner) archiveEntries(archivePath string) []string {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return nil
+	}
+	entries, err := readArchive(archivePath)
+	if err != nil {
+		fmt.Printf("\033[33m⚠️  Could not read archive %s: %v\033[0m\n", archivePath, err)
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if !s.allowedName(path.Base(e.Name)) {
+			continue
+		}
+		if _, ignored := s.ignoredFile(e.Name); ignored {
+			continue
+		}
+		if !s.IncludeEmpty && len(e.Content) == 0 {
+			s.Stats.SkippedEmpty++
+			continue
+		}
+
+		if s.cache != nil {
+			s.cache.store(archivePath+ARCHIVE_SEP+e.Name, info.ModTime(), e.Content)
+		}
+		paths = append(paths, s.relPath(archivePath)+ARCHIVE_SEP+e.Name)
+	}
+	return paths
+}
+
+// readArchiveFile returns the content of an "archive!entry" path, rereading
+// the archive only when it changed since it was cached
+func (s *FileScanner) readArchiveFile(p string) (string, error) {
+	archivePath, name, _ := splitArchivePath(p)
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return "", err
+	}
+	if s.cache != nil {
+		if content, ok := s.cache.lookup(p, info.ModTime()); ok {
+			return content, nil
+		}
+	}
+
+	entries, err := readArchive(archivePath)
+	if err != nil {
+		return "", err
+	}
+	var found *archiveEntry
+	for i, e := range entries {
+		if s.cache != nil {
+			s.cache.store(archivePath+ARCHIVE_SEP+e.Name, info.ModTime(), e.Content)
+		}
+		if e.Name == name {
+			found = &entries[i]
+		}
+	}
+	if found == nil {
+		return "", fmt.Errorf("%s: no entry %s", archivePath, name)
+	}
+	return found.Content, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadQuestions loads a -questions-file: one question per line, blank lines
+// and lines starting with # are skipped
+func ReadQuestions(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var questions []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		questions = append(questions, line)
+	}
+	return questions, nil
+}
+
+// ReadQuestionFile loads a -q-file: the whole file is one question, which
+// may span lines. Lines starting with # are dropped, as in -questions-file,
+// and trailing whitespace is trimmed.
+func ReadQuestionFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// RunBatch asks every question in order. When confirm is set, each question
+// is shown with an estimate of its prompt size, made from the index before
+// any request is sent, and the answer read from confirm decides: run, skip
+// or abort the rest. It returns how many questions failed.
+func (s *Session) RunBatch(questions []string, confirm *bufio.Scanner) int {
+	failed := 0
+	for i, question := range questions {
+		fmt.Printf("\n\033[36m❓ [%d/%d] %s\033[0m\n", i+1, len(questions), question)
+		if confirm != nil {
+			tokens, detail := s.estimatePrompt(question)
+			estimate := ""
+			if s.pricing != nil {
+				estimate = fmt.Sprintf(" (~%s before output)", formatCost(s.pricing.Cost(tokens, 0)))
+			}
+			fmt.Printf("\033[90m   Up to ~%d prompt tokens%s on %s: %s\033[0m\n", tokens, estimate, s.ai.Model(), detail)
+
+			switch s.promptRunSkipAbort(confirm) {
+			case "skip":
+				fmt.Println("\033[90m⏭️  Skipped\033[0m")
+				continue
+			case "abort":
+				fmt.Printf("\033[33m🛑 Aborted, %d questions not asked\033[0m\n", len(questions)-i)
+				return failed
+			}
+		}
+
+		if !s.askInteractive(question) {
+			failed++
+		}
+	}
+	return failed
+}
+
+// estimatePrompt bounds the input tokens question will cost without asking
+// the provider anything: the selection round (exact) plus the largest
+// context the answer can get, the whole index capped by -max-context
+func (s *Session) estimatePrompt(question string) (int, string) {
+	tokens := EstimateTokens(question)
+	switch {
+	case s.noContext:
+		return tokens, "no context"
+	case s.namesOnly:
+		paths := s.indexPaths()
+		return tokens + EstimateTokens(s.scanner.StructureContext(paths)), fmt.Sprintf("names of %d files", len(paths))
+	}
+
+	files := indexTokens(s.index)
+	if s.scanner.MaxContext > 0 {
+		files = min(files, s.scanner.MaxContext)
+	}
+	files += EstimateTokens(s.gitBlocks)
+	if s.rag != nil {
+		return tokens + files, fmt.Sprintf("closest chunks of %d files", len(s.index))
+	}
+
+	selection := 0
+	for _, message := range s.selectionMessages(question) {
+		selection += EstimateTokens(message.Content)
+	}
+	return tokens + selection + files, fmt.Sprintf("~%d for selecting among %d files, up to ~%d for their content", selection, len(s.index), files)
+}
+
+// promptRunSkipAbort asks until it gets run (Enter or r), skip or abort;
+// end of input counts as abort
+func (s *Session) promptRunSkipAbort(input *bufio.Scanner) string {
+	for {
+		fmt.Print("\033[1;34m   [R]un, [s]kip or [a]bort? \033[0m")
+		if !input.Scan() {
+			return "abort"
+		}
+		switch strings.ToLower(strings.TrimSpace(input.Text())) {
+		case "", "r", "run":
+			return "run"
+		case "s", "skip":
+			return "skip"
+		case "a", "abort", "q":
+			return "abort"
+		}
+	}
+}
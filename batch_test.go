@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestRunBatchConfirmsBeforeAnyRequest(t *testing.T) {
+	provider := &mockProvider{Select: []string{"main.go"}}
+	session := newTestSession(t, map[string]string{"main.go": "package main\n"}, provider)
+	session.ai.Stream = false
+
+	questions := []string{"first?", "second?", "third?"}
+	confirm := bufio.NewScanner(strings.NewReader("skip\nrun\n")) // then end of input: abort
+	var failed int
+	out := captureStdout(t, func() { failed = session.RunBatch(questions, confirm) })
+
+	if failed != 0 {
+		t.Errorf("RunBatch failed %d questions:\n%s", failed, out)
+	}
+	// Only "second?" ran: one selection round and one answer
+	if provider.calls != 2 {
+		t.Errorf("provider got %d calls, want 2:\n%s", provider.calls, out)
+	}
+	if n := strings.Count(out, "prompt tokens"); n != 3 {
+		t.Errorf("got %d estimates, want one per question:\n%s", n, out)
+	}
+	if !strings.Contains(out, "1 questions not asked") {
+		t.Errorf("third question not aborted:\n%s", out)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// BOOKMARKS_FILE holds the saved prompts, name -> question, next to the config
+const BOOKMARKS_FILE = "bookmarks.json"
+
+// BookmarksPath is ~/.config/.ollama-interactive/bookmarks.json
+func BookmarksPath() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), BOOKMARKS_FILE), nil
+}
+
+// LoadBookmarks reads the saved prompts; no file yet means none
+func LoadBookmarks() (map[string]string, error) {
+	path, err := BookmarksPath()
+	if err != nil {
+		return nil, err
+	}
+	bookmarks := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return bookmarks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &bookmarks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return bookmarks, nil
+}
+
+// SaveBookmarks writes every saved prompt back
+func SaveBookmarks(bookmarks map[string]string) error {
+	path, err := BookmarksPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(bookmarks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// bookmark handles /bookmark: "<name>" saves the last question, "-d <name>"
+// deletes a bookmark and no argument lists them
+func (s *Session) bookmark(arg string) {
+	bookmarks, err := LoadBookmarks()
+	if err != nil {
+		fmt.Printf("\033[31m❌ Cannot read bookmarks: %v\033[0m\n", err)
+		return
+	}
+	if arg == "" {
+		printBookmarks(bookmarks)
+		return
+	}
+
+	if arg == "-d" {
+		fmt.Println("\033[31m❌ Usage: /bookmark -d <name>\033[0m")
+		return
+	}
+	if name, ok := strings.CutPrefix(arg, "-d "); ok {
+		name = strings.TrimSpace(name)
+		if _, exists := bookmarks[name]; !exists {
+			fmt.Printf("\033[31m❌ No bookmark named %s\033[0m\n", name)
+			return
+		}
+		delete(bookmarks, name)
+		if err := SaveBookmarks(bookmarks); err != nil {
+			fmt.Printf("\033[31m❌ Cannot save bookmarks: %v\033[0m\n", err)
+			return
+		}
+		fmt.Printf("\033[32m🗑️  Deleted bookmark %s\033[0m\n", name)
+		return
+	}
+
+	if !sessionName.MatchString(arg) {
+		fmt.Printf("\033[31m❌ Invalid bookmark name %q (use letters, digits, '.', '-' and '_')\033[0m\n", arg)
+		return
+	}
+	if len(s.turns) == 0 {
+		fmt.Println("\033[33m⚠️  No question to bookmark yet\033[0m")
+		return
+	}
+	_, existed := bookmarks[arg]
+	bookmarks[arg] = s.turns[len(s.turns)-1].Question
+	if err := SaveBookmarks(bookmarks); err != nil {
+		fmt.Printf("\033[31m❌ Cannot save bookmarks: %v\033[0m\n", err)
+		return
+	}
+	if existed {
+		fmt.Printf("\033[32m🔖 Updated bookmark %s (run it with /prompt %s)\033[0m\n", arg, arg)
+	} else {
+		fmt.Printf("\033[32m🔖 Bookmarked the last question as %s (run it with /prompt %s)\033[0m\n", arg, arg)
+	}
+}
+
+// runPrompt handles /prompt: asks a bookmarked question again, or lists
+// the bookmarks without a name
+func (s *Session) runPrompt(name string) {
+	bookmarks, err := LoadBookmarks()
+	if err != nil {
+		fmt.Printf("\033[31m❌ Cannot read bookmarks: %v\033[0m\n", err)
+		return
+	}
+	if name == "" {
+		printBookmarks(bookmarks)
+		return
+	}
+	question, ok := bookmarks[name]
+	if !ok {
+		fmt.Printf("\033[31m❌ No bookmark named %s (see /prompt for the list)\033[0m\n", name)
+		return
+	}
+	fmt.Printf("\033[36m🔖 %s\033[0m\n", question)
+	s.askInteractive(question)
+}
+
+func printBookmarks(bookmarks map[string]string) {
+	if len(bookmarks) == 0 {
+		fmt.Println("\033[90mNo bookmarks yet (save the last question with /bookmark <name>)\033[0m")
+		return
+	}
+	names := make([]string, 0, len(bookmarks))
+	for name := range bookmarks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	fmt.Println("\033[36m🔖 Bookmarks:\033[0m")
+	for _, name := range names {
+		question := []rune(strings.ReplaceAll(bookmarks[name], "\n", " "))
+		if len(question) > 70 {
+			question = append(question[:67], []rune("...")...)
+		}
+		fmt.Printf("   \033[90m%-16s\033[0m %s\n", name, string(question))
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BREAKDOWN_BAR_WIDTH is the length of the bar of a directory holding everything
+const BREAKDOWN_BAR_WIDTH = 20
+
+// DirShare is one row of -context-breakdown
+type DirShare struct {
+	Dir   string // Root-relative with a trailing slash, "./" for files at the root
+	Files int
+	Bytes int64
+}
+
+// ContextBreakdown sums the indexed file sizes by directory, cut to depth
+// path segments, largest first
+func ContextBreakdown(index []FileIndex, depth int) []DirShare {
+	depth = max(depth, 1)
+	shares := make(map[string]*DirShare)
+	for _, idx := range index {
+		path := idx.Path
+		if archive, _, ok := splitArchivePath(path); ok {
+			path = archive // entries count toward the archive's directory
+		}
+		segments := strings.Split(filepath.ToSlash(filepath.Dir(path)), "/")
+		dir := "./"
+		if segments[0] != "." {
+			dir = strings.Join(segments[:min(depth, len(segments))], "/") + "/"
+		}
+		if shares[dir] == nil {
+			shares[dir] = &DirShare{Dir: dir}
+		}
+		shares[dir].Files++
+		shares[dir].Bytes += idx.Size
+	}
+
+	rows := make([]DirShare, 0, len(shares))
+	for _, share := range shares {
+		rows = append(rows, *share)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Bytes != rows[j].Bytes {
+			return rows[i].Bytes > rows[j].Bytes
+		}
+		return rows[i].Dir < rows[j].Dir
+	})
+	return rows
+}
+
+// printContextBreakdown prints the ContextBreakdown table with each
+// directory's share of the estimated tokens
+func printContextBreakdown(index []FileIndex, depth int) {
+	rows := ContextBreakdown(index, depth)
+	if len(rows) == 0 {
+		return
+	}
+	var total int64
+	width := 0
+	for _, row := range rows {
+		total += row.Bytes
+		width = max(width, len(row.Dir))
+	}
+
+	fmt.Printf("\033[36m📊 Context by directory (~%d tokens in %d files):\033[0m\n", indexTokens(index), len(index))
+	for _, row := range rows {
+		share := 0.0
+		if total > 0 {
+			share = float64(row.Bytes) / float64(total)
+		}
+		bar := strings.Repeat("█", int(share*BREAKDOWN_BAR_WIDTH+0.5))
+		tokens := (row.Bytes + CHARS_PER_TOKEN - 1) / CHARS_PER_TOKEN
+		fmt.Printf("   %-*s %5.1f%%  %15s  %5d files  \033[36m%s\033[0m\n", width, row.Dir, share*100, fmt.Sprintf("~%d tokens", tokens), row.Files, bar)
+	}
+}
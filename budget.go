@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MIN_TRUNCATED_TOKENS is the smallest leftover budget worth filling with
+// the head of a file that doesn't fit whole
+const MIN_TRUNCATED_TOKENS = 256
+
+// BUDGET_TRUNCATED_MARKER ends a file cut short by -max-context
+const BUDGET_TRUNCATED_MARKER = "\n... [truncated to fit -max-context]"
+
+// lowPriorityNames are lock and build files that rarely help an answer
+var lowPriorityNames = map[string]bool{
+	"package-lock.json": true, "yarn.lock": true, "pnpm-lock.yaml": true, "bun.lockb": true,
+	"go.sum": true, "cargo.lock": true, "composer.lock": true, "poetry.lock": true, "gemfile.lock": true,
+}
+
+// ParseContextSize reads a -max-context value as estimated tokens: a plain
+// count ("8000", "32k") or a size in bytes ("256KB", "1MB", "90000B")
+func ParseContextSize(value string) (int, error) {
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	units := []struct {
+		suffix string
+		bytes  int
+	}{{"KB", 1024}, {"MB", 1024 * 1024}, {"B", 1}, {"K", 0}}
+	for _, unit := range units {
+		number, ok := strings.CutSuffix(upper, unit.suffix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(number))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid size %q", value)
+		}
+		if unit.bytes == 0 {
+			return n * 1000, nil // "32k" tokens
+		}
+		return (n*unit.bytes + CHARS_PER_TOKEN - 1) / CHARS_PER_TOKEN, nil
+	}
+	n, err := strconv.Atoi(upper)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (use tokens like 8000 or 32k, or bytes like 256KB)", value)
+	}
+	return n, nil
+}
+
+// lowPriority reports lock files, minified bundles and generated code, the
+// first to go when the context is over budget
+func lowPriority(fc FileContent) bool {
+	name := strings.ToLower(filepath.Base(fc.Path))
+	return lowPriorityNames[name] || strings.Contains(name, ".min.") || generatedMarker.MatchString(fc.Content)
+}
+
+// BudgetReport says what FitBudget kept out of the context
+type BudgetReport struct {
+	Budget    int      // Estimated tokens allowed
+	Tokens    int      // Estimated tokens of the files kept
+	Dropped   []string // Files left out entirely, or "path (part i/n)" for parts of a split file
+	Truncated string   // File (or part) kept only in part, "" = none
+}
+
+// kept returns paths without the files the budget dropped
+func (r BudgetReport) kept(paths []string) []string {
+	return slices.DeleteFunc(paths, func(path string) bool {
+		return slices.Contains(r.Dropped, path)
+	})
+}
+
+// FitBudget keeps files within budget estimated tokens. Files for which keep
+// returns true (pins, /focus) go first, then source before lock and
+// generated files, smaller before larger; the first file that doesn't fit
+// is cut to the remaining space when that is at least MIN_TRUNCATED_TOKENS.
+// Parts of split files (SplitFiles) are weighed one by one, earlier parts
+// first, and a file whose parts were all dropped is reported as a whole.
+// The kept files stay in their original order. A budget of 0 keeps all.
+func FitBudget(files []FileContent, budget int, keep func(path string) bool) ([]FileContent, BudgetReport) {
+	report := BudgetReport{Budget: budget}
+	costs := make([]int, len(files))
+	for i, fc := range files {
+		costs[i] = EstimateTokens(formatFileBlock(fc.label(fc.Path), fc.Content))
+		report.Tokens += costs[i]
+	}
+	if budget <= 0 || report.Tokens <= budget {
+		return files, report
+	}
+
+	low := make(map[string]bool) // by path: a generated marker sits in the first part only
+	for _, fc := range files {
+		low[fc.Path] = low[fc.Path] || lowPriority(fc)
+	}
+	rank := func(i int) int {
+		switch {
+		case keep != nil && keep(files[i].Path):
+			return 0
+		case low[files[i].Path]:
+			return 2
+		default:
+			return 1
+		}
+	}
+	byPriority := make([]int, len(files))
+	for i := range byPriority {
+		byPriority[i] = i
+	}
+	sort.SliceStable(byPriority, func(a, b int) bool {
+		i, j := byPriority[a], byPriority[b]
+		if rank(i) != rank(j) {
+			return rank(i) < rank(j)
+		}
+		if pi, pj := max(files[i].Part, 1), max(files[j].Part, 1); pi != pj {
+			return pi < pj
+		}
+		return costs[i] < costs[j]
+	})
+
+	report.Tokens = 0
+	included := make([]bool, len(files))
+	kept := slices.Clone(files)
+	for _, i := range byPriority {
+		remaining := budget - report.Tokens
+		switch {
+		case costs[i] <= remaining:
+			included[i] = true
+			report.Tokens += costs[i]
+		case report.Truncated == "" && remaining >= MIN_TRUNCATED_TOKENS:
+			label := files[i].label(files[i].Path)
+			kept[i].Content = truncateToTokens(files[i].Content, remaining-EstimateTokens(formatFileBlock(label, BUDGET_TRUNCATED_MARKER)))
+			included[i] = true
+			report.Truncated = label
+			report.Tokens += EstimateTokens(formatFileBlock(label, kept[i].Content))
+		}
+	}
+
+	// Dropped in file order; a split file with no part left counts as one file
+	partsKept := make(map[string]bool)
+	for i, fc := range files {
+		partsKept[fc.Path] = partsKept[fc.Path] || included[i]
+	}
+	for i, fc := range files {
+		switch {
+		case included[i]:
+		case !partsKept[fc.Path] && fc.Part <= 1:
+			report.Dropped = append(report.Dropped, fc.Path)
+		case partsKept[fc.Path]:
+			report.Dropped = append(report.Dropped, fc.label(fc.Path))
+		}
+	}
+
+	result := make([]FileContent, 0, len(files))
+	for i, fc := range kept {
+		if included[i] {
+			result = append(result, fc)
+		}
+	}
+	return result, report
+}
+
+// truncateToTokens cuts content to about tokens estimated tokens, at a line
+// boundary when there is one, and marks the cut
+func truncateToTokens(content string, tokens int) string {
+	limit := min(len(content), max(tokens, 0)*CHARS_PER_TOKEN)
+	cut := content[:limit]
+	if nl := strings.LastIndexByte(cut, '\n'); nl > 0 {
+		cut = cut[:nl]
+	}
+	return cut + BUDGET_TRUNCATED_MARKER
+}
+
+// printBudgetReport lists what -max-context left out, if anything
+func printBudgetReport(report BudgetReport) {
+	if report.Budget <= 0 || (len(report.Dropped) == 0 && report.Truncated == "") {
+		return
+	}
+	fmt.Printf("\033[33m📦 Over the -max-context budget: kept ~%d of %d tokens, %d files dropped\033[0m\n", report.Tokens, report.Budget, len(report.Dropped))
+	if report.Truncated != "" {
+		fmt.Printf("   \033[90m✂️  %s (truncated)\033[0m\n", report.Truncated)
+	}
+	for _, path := range report.Dropped {
+		fmt.Printf("   \033[90m- %s (dropped)\033[0m\n", path)
+	}
+}
+
+// formatContextTokens describes a context size, against the budget when set
+func formatContextTokens(tokens int, budget int) string {
+	if budget <= 0 {
+		return fmt.Sprintf("~%d tokens", tokens)
+	}
+	return fmt.Sprintf("~%d of %d tokens (-max-context)", tokens, budget)
+}
+
+// indexTokens estimates what sending every indexed file would cost
+func indexTokens(index []FileIndex) int {
+	var size int64
+	for _, idx := range index {
+		size += idx.Size
+	}
+	return int((size + CHARS_PER_TOKEN - 1) / CHARS_PER_TOKEN)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// bigFile has 80 lines of 10 estimated tokens each: four parts of 200 tokens
+var bigFile = strings.Repeat("// "+strings.Repeat("x", 36)+"\n", 80)
+
+func TestFitBudgetDropsSplitPartsOneByOne(t *testing.T) {
+	files := SplitFiles([]FileContent{
+		{Path: "big.go", Content: bigFile},
+		{Path: "small.go", Content: "package main\n"},
+	}, 200)
+	if len(files) != 5 {
+		t.Fatalf("SplitFiles made %d blocks, want 4 parts and 1 file", len(files))
+	}
+
+	kept, report := FitBudget(files, 500, nil)
+	var labels []string
+	for _, fc := range kept {
+		labels = append(labels, fc.label(fc.Path))
+	}
+	if want := []string{"big.go (part 1/4)", "big.go (part 2/4)", "small.go"}; !slices.Equal(labels, want) {
+		t.Errorf("kept %q, want %q", labels, want)
+	}
+	if want := []string{"big.go (part 3/4)", "big.go (part 4/4)"}; !slices.Equal(report.Dropped, want) {
+		t.Errorf("Dropped = %q, want %q", report.Dropped, want)
+	}
+	if report.Tokens > 500 {
+		t.Errorf("kept ~%d tokens, over the budget of 500", report.Tokens)
+	}
+	if got := report.kept([]string{"big.go", "small.go"}); len(got) != 2 {
+		t.Errorf("kept(paths) = %q, a partly kept file must stay listed", got)
+	}
+}
+
+func TestFitBudgetReportsFullyDroppedSplitFile(t *testing.T) {
+	files := SplitFiles([]FileContent{
+		{Path: "big.go", Content: bigFile},
+		{Path: "small.go", Content: "package main\n"},
+	}, 200)
+
+	kept, report := FitBudget(files, 50, nil)
+	if len(kept) != 1 || kept[0].Path != "small.go" {
+		t.Errorf("kept %+v, want only small.go", kept)
+	}
+	if want := []string{"big.go"}; !slices.Equal(report.Dropped, want) {
+		t.Errorf("Dropped = %q, want %q", report.Dropped, want)
+	}
+}
+
+func TestFitBudgetTruncatesAPart(t *testing.T) {
+	files := SplitFiles([]FileContent{{Path: "big.go", Content: bigFile}}, 400)
+
+	kept, report := FitBudget(files, 700, nil)
+	if report.Truncated != "big.go (part 2/2)" {
+		t.Errorf("Truncated = %q, want the last part", report.Truncated)
+	}
+	if len(kept) != 2 || kept[0].Content != files[0].Content || !strings.HasSuffix(kept[1].Content, BUDGET_TRUNCATED_MARKER) {
+		t.Errorf("want part 1 whole and part 2 truncated, got %d blocks", len(kept))
+	}
+	if len(report.Dropped) != 0 {
+		t.Errorf("Dropped = %q, want none", report.Dropped)
+	}
+}
+
+func TestBuildContextBudgetsSplitParts(t *testing.T) {
+	session := newTestSession(t, map[string]string{
+		"big.go":   bigFile,
+		"small.go": "package main\n",
+	}, &mockProvider{})
+	session.scanner.SplitTokens = 200
+	session.scanner.MaxContext = 500
+
+	repoContext, _, _, report := session.buildContext(context.Background(), []string{"big.go", "small.go"})
+	for _, want := range []string{"--- FILE: big.go (part 1/4) ---", "--- FILE: big.go (part 2/4) ---", "--- FILE: small.go ---"} {
+		if !strings.Contains(repoContext, want) {
+			t.Errorf("context is missing %q", want)
+		}
+	}
+	if strings.Contains(repoContext, "(part 3/4)") || strings.Contains(repoContext, "(part 4/4)") {
+		t.Errorf("context has parts over the budget")
+	}
+	if EstimateTokens(repoContext) > 500 {
+		t.Errorf("context is ~%d tokens, over the budget of 500", EstimateTokens(repoContext))
+	}
+	if got := report.kept([]string{"big.go", "small.go"}); !slices.Equal(got, []string{"big.go", "small.go"}) {
+		t.Errorf("kept(paths) = %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// ContentCache keeps file contents read during the session, keyed by path
+// and invalidated whenever the file's modification time changes. It is safe
+// for concurrent use by the scan workers.
+type ContentCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	modTime time.Time
+	size    int64
+	content string
+}
+
+func NewContentCache() *ContentCache {
+	return &ContentCache{entries: make(map[string]cacheEntry)}
+}
+
+// ReadFile returns the content of path, hitting the disk only when the file
+// is new to the cache or has changed since it was last read
+func (c *ContentCache) ReadFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		c.Invalidate(path)
+		return "", err
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[path]
+	c.mu.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.content, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.entries[path] = cacheEntry{modTime: info.ModTime(), size: info.Size(), content: string(data)}
+	c.mu.Unlock()
+	return string(data), nil
+}
+
+// lookup returns the cached content for key if it was stored for modTime
+func (c *ContentCache) lookup(key string, modTime time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !entry.modTime.Equal(modTime) {
+		return "", false
+	}
+	return entry.content, true
+}
+
+// store records content for key, e.g. an archive entry read along with its archive
+func (c *ContentCache) store(key string, modTime time.Time, content string) {
+	c.mu.Lock()
+	c.entries[key] = cacheEntry{modTime: modTime, size: int64(len(content)), content: content}
+	c.mu.Unlock()
+}
+
+// Invalidate drops the cached content for path
+func (c *ContentCache) Invalidate(path string) {
+	c.mu.Lock()
+	delete(c.entries, path)
+	c.mu.Unlock()
+}
+
+// ReadFile reads a file (or "archive!entry" path) through the scanner's
+// content cache, then through its -preprocess command if it has one
+func (s *FileScanner) ReadFile(path string) (string, error) {
+	content, err := s.readRaw(s.absPath(path))
+	if err != nil || len(s.Preprocessors) == 0 {
+		return content, err
+	}
+	return s.preprocess(s.absPath(path), content)
+}
+
+func (s *FileScanner) readRaw(path string) (string, error) {
+	if _, _, ok := splitArchivePath(path); ok {
+		return s.readArchiveFile(path)
+	}
+	if s.cache == nil {
+		data, err := os.ReadFile(path)
+		return string(data), err
+	}
+	return s.cache.ReadFile(path)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CHECKPOINT_EVERY is how many newly indexed files trigger a checkpoint write
+const CHECKPOINT_EVERY = 200
+
+// Checkpoint records the index entries built so far for one scan root, so an
+// interrupted scan can pick up where it stopped with -resume. It is stored as
+// JSON in ~/.config/.ollama-interactive/checkpoints/<hash of root>.json:
+//
+//	{
+//	  "root": "/abs/path/to/repo",
+//	  "updated": "2026-01-02T15:04:05Z",
+//	  "entries": {
+//	    "<path>": {"size": 1234, "mod_time": "...", "summary": "<first 500 bytes>"}
+//	  }
+//	}
+//
+// An entry is reused only while the file's size and modification time still
+// match. The file is removed once a scan completes.
+type Checkpoint struct {
+	Root    string                     `json:"root"`
+	Updated time.Time                  `json:"updated"`
+	Entries map[string]CheckpointEntry `json:"entries"`
+
+	path  string // Where the checkpoint is saved
+	dirty int    // Entries added since the last save
+}
+
+type CheckpointEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Summary string    `json:"summary"`
+}
+
+// CheckpointPath returns the checkpoint file used for the given scan root
+func CheckpointPath(root string) (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(filepath.Dir(configPath), "checkpoints", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// OpenCheckpoint prepares a checkpoint for root. With resume set, entries
+// from a previous interrupted scan are loaded; otherwise it starts empty.
+func OpenCheckpoint(root string, resume bool) (*Checkpoint, error) {
+	path, err := CheckpointPath(root)
+	if err != nil {
+		return nil, err
+	}
+	abs, _ := filepath.Abs(root)
+	cp := &Checkpoint{Root: abs, Entries: make(map[string]CheckpointEntry), path: path}
+	if !resume {
+		return cp, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	if cp.Entries == nil {
+		cp.Entries = make(map[string]CheckpointEntry)
+	}
+	return cp, nil
+}
+
+// lookup returns the stored summary for path if the file hasn't changed
+func (cp *Checkpoint) lookup(path string) (string, bool) {
+	entry, ok := cp.Entries[path]
+	if !ok {
+		return "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime) {
+		return "", false
+	}
+	return entry.Summary, true
+}
+
+// record adds a freshly read summary and saves every CHECKPOINT_EVERY entries
+func (cp *Checkpoint) record(path string, summary string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil // Archive entries and vanished files aren't checkpointed
+	}
+	cp.Entries[path] = CheckpointEntry{Size: info.Size(), ModTime: info.ModTime(), Summary: summary}
+	cp.dirty++
+	if cp.dirty < CHECKPOINT_EVERY {
+		return nil
+	}
+	return cp.Save()
+}
+
+// Save writes the checkpoint atomically (temp file + rename)
+func (cp *Checkpoint) Save() error {
+	cp.Updated = time.Now()
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cp.path), 0755); err != nil {
+		return err
+	}
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	cp.dirty = 0
+	return os.Rename(tmp, cp.path)
+}
+
+// Remove deletes the checkpoint file after a completed scan
+func (cp *Checkpoint) Remove() error {
+	err := os.Remove(cp.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// CodeBlock is one fenced block extracted from an answer
+type CodeBlock struct {
+	Lang     string // First word of the fence info, lowercased
+	Filename string // Inferred name; falls back to snippet-N.<ext>
+	Content  string
+}
+
+// langExts maps fence languages to file extensions
+var langExts = map[string]string{
+	"go": ".go", "golang": ".go",
+	"ts": ".ts", "typescript": ".ts", "tsx": ".tsx",
+	"js": ".js", "javascript": ".js", "jsx": ".jsx",
+	"svelte": ".svelte", "html": ".html", "css": ".css",
+	"sql": ".sql", "yaml": ".yml", "yml": ".yml", "json": ".json", "toml": ".toml",
+	"rust": ".rs", "rs": ".rs", "python": ".py", "py": ".py",
+	"sh": ".sh", "bash": ".sh", "zsh": ".zsh", "fish": ".fish",
+	"dockerfile": "Dockerfile", "makefile": "Makefile", "just": "justfile",
+	"md": ".md", "markdown": ".md",
+}
+
+// shellLangs are fence languages whose files get the executable bit
+var shellLangs = map[string]bool{"sh": true, "bash": true, "zsh": true, "fish": true, "shell": true}
+
+var (
+	fenceOpen = regexp.MustCompile("^(`{3,}|~{3,})\\s*(.*)$")
+	// file=path, title="path" or {filename=path} in the fence info
+	fenceFileAttr = regexp.MustCompile(`(?:file|filename|title|path)=["']?([^"'\s}]+)`)
+	// "// file: path", "# path/to/x.sh", "-- file: x.sql" on the first line
+	commentFile = regexp.MustCompile(`^\s*(?://|#|--|<!--)\s*(?:file(?:name)?:\s*)?([\w./-]+\.[\w]+|Dockerfile|Makefile|justfile)\s*(?:-->)?\s*$`)
+)
+
+// ExtractCodeBlocks returns the fenced code blocks of a Markdown answer with
+// their language and an inferred filename. A name is taken from the fence
+// info ("```go main.go", "```go:main.go", "```go title=main.go"), then from
+// a comment on the first line; otherwise it is snippet-N plus the extension
+// for the language.
+func ExtractCodeBlocks(markdown string) []CodeBlock {
+	var blocks []CodeBlock
+	lines := strings.Split(markdown, "\n")
+	for i := 0; i < len(lines); i++ {
+		match := fenceOpen.FindStringSubmatch(strings.TrimSpace(lines[i]))
+		if match == nil {
+			continue
+		}
+		fence, info := match[1], match[2]
+
+		var body []string
+		for i++; i < len(lines); i++ {
+			if trimmed := strings.TrimSpace(lines[i]); strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				break
+			}
+			body = append(body, lines[i])
+		}
+
+		lang, name := parseFenceInfo(info)
+		if name == "" && len(body) > 0 {
+			if m := commentFile.FindStringSubmatch(body[0]); m != nil {
+				name = m[1]
+			}
+		}
+		if lang == "" && len(body) > 0 && strings.HasPrefix(body[0], "#!") {
+			lang = shebangLang(body[0])
+		}
+		if name == "" {
+			name = fmt.Sprintf("snippet-%d%s", len(blocks)+1, extensionFor(lang))
+		}
+		blocks = append(blocks, CodeBlock{Lang: lang, Filename: name, Content: strings.Join(body, "\n") + "\n"})
+	}
+	return blocks
+}
+
+// parseFenceInfo splits the fence info into a language and an optional filename
+func parseFenceInfo(info string) (string, string) {
+	var name string
+	if m := fenceFileAttr.FindStringSubmatch(info); m != nil {
+		name = m[1]
+	}
+	fields := strings.Fields(strings.Trim(info, "{}"))
+	if len(fields) == 0 {
+		return "", name
+	}
+
+	lang, file, hasFile := strings.Cut(fields[0], ":")
+	switch {
+	case name != "":
+	case hasFile:
+		name = file
+	case len(fields) > 1 && !strings.Contains(fields[1], "=") && strings.ContainsAny(fields[1], "./"):
+		name = fields[1]
+	}
+	return strings.ToLower(lang), name
+}
+
+// shebangLang guesses the language from a "#!" line
+func shebangLang(line string) string {
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" && len(fields) > 1 {
+		interpreter = fields[1]
+	}
+	if interpreter == "python3" {
+		return "python"
+	}
+	return interpreter
+}
+
+// extensionFor maps a fence language to an extension. Generic "shell" and
+// "console" blocks follow the user's $SHELL, so zsh users get .zsh.
+func extensionFor(lang string) string {
+	if lang == "shell" || lang == "console" {
+		switch filepath.Base(os.Getenv("SHELL")) {
+		case "zsh":
+			return ".zsh"
+		case "fish":
+			return ".fish"
+		}
+		return ".sh"
+	}
+	if ext, ok := langExts[lang]; ok {
+		if !strings.HasPrefix(ext, ".") {
+			return "-" + ext // e.g. snippet-1-Dockerfile
+		}
+		return ext
+	}
+	return ".txt"
+}
+
+// isShellScript reports whether a block should be written executable
+func (b CodeBlock) isShellScript() bool {
+	switch filepath.Ext(b.Filename) {
+	case ".sh", ".bash", ".zsh", ".fish":
+		return true
+	}
+	return shellLangs[b.Lang] || strings.HasPrefix(b.Content, "#!")
+}
+
+// WriteCodeBlocks writes each block under dir, refusing names that escape it
+// and never overwriting existing files. Shell scripts are made executable.
+// It returns the paths written.
+func WriteCodeBlocks(dir string, blocks []CodeBlock) ([]string, error) {
+	var written []string
+	for _, block := range blocks {
+		name := filepath.Clean(block.Filename)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return written, fmt.Errorf("refusing to write outside %s: %s", dir, block.Filename)
+		}
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return written, fmt.Errorf("%s already exists", path)
+		}
+
+		mode := os.FileMode(0644)
+		if block.isShellScript() {
+			mode = 0755
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return written, err
+		}
+		if err := os.WriteFile(path, []byte(block.Content), mode); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// CloseFences appends the closing fence of a code block left open at the end
+// of markdown, as in an answer cut off by a timeout or cancel, so glamour
+// still renders it as code. The closer repeats the opener (``` or ~~~, same
+// length); complete answers are returned unchanged.
+func CloseFences(markdown string) string {
+	open := ""
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if open != "" {
+			if strings.HasPrefix(trimmed, open) && strings.Trim(trimmed, open[:1]) == "" {
+				open = ""
+			}
+			continue
+		}
+		if match := fenceOpen.FindStringSubmatch(trimmed); match != nil {
+			open = match[1]
+		}
+	}
+	if open == "" {
+		return markdown
+	}
+	if !strings.HasSuffix(markdown, "\n") {
+		markdown += "\n"
+	}
+	return markdown + open + "\n"
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractCodeBlocksMixedLanguages(t *testing.T) {
+	t.Setenv("SHELL", "/usr/bin/zsh")
+	answer := "Here is the server:\n\n" +
+		"```go main.go\npackage main\n```\n\n" +
+		"And a migration:\n\n" +
+		"```sql\n-- file: db/001_init.sql\nCREATE TABLE users (id INT);\n```\n\n" +
+		"A script with no language:\n\n" +
+		"```\n#!/usr/bin/env bash\necho hi\n```\n\n" +
+		"```shell\nmake build\n```\n\n" +
+		"~~~ts title=\"web/app.ts\"\nexport {}\n~~~\n\n" +
+		"```python\nprint(1)\n```\n\n" +
+		"```\nplain text\n```\n"
+
+	want := []struct {
+		lang, name string
+		shell      bool
+	}{
+		{"go", "main.go", false},
+		{"sql", "db/001_init.sql", false},
+		{"bash", "snippet-3.sh", true},
+		{"shell", "snippet-4.zsh", true},
+		{"ts", "web/app.ts", false},
+		{"python", "snippet-6.py", false},
+		{"", "snippet-7.txt", false},
+	}
+	blocks := ExtractCodeBlocks(answer)
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d: %+v", len(blocks), len(want), blocks)
+	}
+	for i, w := range want {
+		b := blocks[i]
+		if b.Lang != w.lang || b.Filename != w.name || b.isShellScript() != w.shell {
+			t.Errorf("block %d = (%q, %q, shell %v), want (%q, %q, shell %v)",
+				i+1, b.Lang, b.Filename, b.isShellScript(), w.lang, w.name, w.shell)
+		}
+	}
+}
+
+func TestWriteCodeBlocksMixedLanguages(t *testing.T) {
+	dir := t.TempDir()
+	blocks := ExtractCodeBlocks("```go cmd/main.go\npackage main\n```\n\n```sh run.sh\necho hi\n```\n")
+	written, err := WriteCodeBlocks(dir, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 2 {
+		t.Fatalf("wrote %q, want 2 files", written)
+	}
+
+	for name, exec := range map[string]bool{"cmd/main.go": false, "run.sh": true} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode()&0o111 != 0; got != exec {
+			t.Errorf("%s executable = %v, want %v", name, got, exec)
+		}
+	}
+	if _, err := WriteCodeBlocks(dir, blocks[:1]); err == nil {
+		t.Error("WriteCodeBlocks overwrote an existing file")
+	}
+}
+
+func TestCloseFences(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{"complete", "text\n```go\nx := 1\n```\n", "text\n```go\nx := 1\n```\n"},
+		{"no code", "just text", "just text"},
+		{"truncated", "text\n```go\nx := 1", "text\n```go\nx := 1\n```\n"},
+		{"truncated with newline", "```go\nx := 1\n", "```go\nx := 1\n```\n"},
+		{"long fence", "````md\n```go\ninner\n```\nstill open", "````md\n```go\ninner\n```\nstill open\n````\n"},
+		{"tilde fence", "~~~sh\necho hi", "~~~sh\necho hi\n~~~\n"},
+		{"second block truncated", "```go\na\n```\n\n```ts\nb", "```go\na\n```\n\n```ts\nb\n```\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := CloseFences(tc.in)
+			if got != tc.want {
+				t.Errorf("CloseFences(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+			if blocks := ExtractCodeBlocks(got); len(ExtractCodeBlocks(tc.in)) != len(blocks) {
+				t.Errorf("closing changed the block count to %d", len(blocks))
+			}
+		})
+	}
+}
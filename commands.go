@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// HandleCommand runs a /command typed at the prompt
+func (s *Session) HandleCommand(input string) {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(input, "/"), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "help":
+		s.printHelp()
+	case "why":
+		if arg == "" {
+			fmt.Println("\033[31m❌ Usage: /why <path>\033[0m")
+			return
+		}
+		s.explainPath(arg)
+	case "add", "drop":
+		if s.noContext {
+			fmt.Println("\033[33m⚠️  No repository context in this session (-no-context)\033[0m")
+			return
+		}
+		if arg == "" {
+			fmt.Printf("\033[31m❌ Usage: /%s <path|glob>\033[0m\n", name)
+			return
+		}
+		if name == "add" {
+			s.addToContext(arg)
+		} else {
+			s.dropFromContext(arg)
+		}
+	case "rescan", "reload", "files":
+		if s.noContext {
+			fmt.Println("\033[33m⚠️  No repository context in this session (-no-context)\033[0m")
+			return
+		}
+		switch name {
+		case "rescan":
+			s.rescan()
+		case "reload":
+			s.reload()
+		default:
+			s.listFiles(arg)
+		}
+	case "tokens":
+		s.printTokens()
+	case "diff", "staged":
+		if name == "staged" && arg != "" {
+			fmt.Println("\033[31m❌ Usage: /staged\033[0m")
+			return
+		}
+		s.attachDiff(name == "staged", arg)
+	case "model":
+		s.switchModel(arg)
+	case "focus":
+		s.setFocus(arg)
+	case "undo":
+		s.undoLast()
+	case "editor":
+		question, err := editQuestion()
+		if err != nil {
+			fmt.Printf("\033[31m❌ Editor failed: %v\033[0m\n", err)
+			return
+		}
+		if question == "" {
+			fmt.Println("\033[90mEmpty question, nothing sent.\033[0m")
+			return
+		}
+		s.askInteractive(question)
+	case "write":
+		s.writeLastBlocks(arg)
+	case "tag":
+		s.tagTurn(arg)
+	case "history":
+		s.printHistory(arg)
+	case "run":
+		s.runCommand(arg)
+	case "bookmark":
+		s.bookmark(arg)
+	case "prompt":
+		s.runPrompt(arg)
+	case "reset", "clear":
+		s.ai.ResetHistory()
+		fmt.Println("\033[32m🧹 Conversation history cleared (files stay loaded)\033[0m")
+	case "append-to":
+		if arg == "" {
+			fmt.Println("\033[31m❌ Usage: /append-to <file>\033[0m")
+			return
+		}
+		s.appendLastAnswer(arg)
+	default:
+		fmt.Printf("\033[31m❌ Unknown command: /%s (try /help)\033[0m\n", name)
+	}
+}
+
+func (s *Session) printHelp() {
+	fmt.Println("\033[36m📖 Session commands:\033[0m")
+	fmt.Println("   \033[90m/help\033[0m          Show this list")
+	fmt.Println("   \033[90m/why <path>\033[0m    Explain why a file is or isn't in the context")
+	fmt.Println("   \033[90m/add <glob>\033[0m    Pin files into every question's context")
+	fmt.Println("   \033[90m/drop <glob>\033[0m   Remove files from the context")
+	fmt.Println("   \033[90m/files [glob]\033[0m  List the files in the context with their estimated size")
+	fmt.Println("   \033[90m/rescan\033[0m        Rebuild the file index from disk")
+	fmt.Println("   \033[90m/reload\033[0m        Rescan and list the files added, changed or deleted since")
+	fmt.Println("   \033[90m/tokens\033[0m        Estimate the context the next question carries")
+	fmt.Println("   \033[90m/undo\033[0m          Revert the last /add, /drop, /rescan or /reload")
+	fmt.Println("   \033[90m/focus <glob>\033[0m  Put matching files first and ask for extra attention")
+	fmt.Println("   \033[90m/editor\033[0m        Write the question in $EDITOR")
+	fmt.Println("   \033[90m/append-to <f>\033[0m Append the last answer to a Markdown file")
+	fmt.Println("   \033[90m/write [dir]\033[0m   Save the code blocks of the last answer as files")
+	fmt.Println("   \033[90m/tag <name>\033[0m    Tag the next answer (\"/tag -last <name>\" tags the previous one)")
+	fmt.Println("   \033[90m/history [n]\033[0m   Reprint the last n answers (all by default)")
+	fmt.Println("   \033[90m/run <cmd>\033[0m     Run a shell command and attach its output to the next question")
+	fmt.Println("   \033[90m/diff [rev]\033[0m    Attach the unstaged changes (or those since rev) to the next question")
+	fmt.Println("   \033[90m/staged\033[0m        Attach the staged changes to the next question")
+	fmt.Println("   \033[90m/bookmark <n>\033[0m  Save the last question as n (\"/bookmark -d <n>\" deletes, no name lists)")
+	fmt.Println("   \033[90m/prompt <n>\033[0m    Ask the question bookmarked as n again")
+	fmt.Println("   \033[90m/clear, /reset\033[0m Forget earlier questions and answers, start a fresh conversation")
+	fmt.Println("   \033[90m/model [name]\033[0m  List the provider's models, or switch to one for this session")
+	fmt.Println("   \033[90mmodel\033[0m          Pick the model from a list and save it as the default")
+	fmt.Println("   \033[90mexit, quit\033[0m     Close the session")
+}
+
+// askInteractive runs a question from the prompt, framed by separators, and
+// reports whether it was answered
+func (s *Session) askInteractive(question string) bool {
+	fmt.Println(separator())
+
+	// Ctrl-C cancels this answer only; at the prompt it still ends the session
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := s.AskQuestion(ctx, question)
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Println("\033[33m⏹️  Answer canceled (Ctrl-C), ask again or type exit\033[0m")
+		} else {
+			fmt.Printf("\033[31mAI Error: %v\033[0m\n", err)
+		}
+	}
+
+	fmt.Println(separator())
+	return err == nil
+}
+
+// editQuestion opens $VISUAL or $EDITOR (vi if neither is set) on a temp
+// file and returns what was saved
+func editQuestion() (string, error) {
+	fields := strings.Fields(os.Getenv("VISUAL"))
+	if len(fields) == 0 {
+		fields = strings.Fields(os.Getenv("EDITOR"))
+	}
+	if len(fields) == 0 {
+		fields = []string{"vi"}
+	}
+
+	f, err := os.CreateTemp("", "viber-question-*.md")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	cmd := exec.Command(fields[0], append(fields[1:], f.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// explainPath reports whether path is in the index and the last question's
+// context, and which filter removed it otherwise
+func (s *Session) explainPath(path string) {
+	if s.noContext {
+		fmt.Println("\033[33m⚠️  No repository context in this session (-no-context)\033[0m")
+		return
+	}
+	path = s.resolvePath(path)
+
+	if s.dropped[path] {
+		fmt.Printf("\033[33m🚫 %s was removed with /drop (use /undo or /add to bring it back)\033[0m\n", path)
+		return
+	}
+	if slices.Contains(s.pinned, path) {
+		fmt.Printf("\033[32m📌 %s is pinned with /add and sent with every question\033[0m\n", path)
+		return
+	}
+
+	indexed := slices.ContainsFunc(s.index, func(idx FileIndex) bool {
+		return idx.Path == path
+	})
+	if !indexed {
+		fmt.Printf("\033[33m🚫 %s is not indexed: %s\033[0m\n", path, s.scanner.Explain(path))
+		return
+	}
+
+	fmt.Printf("\033[32m✅ %s is indexed\033[0m\n", path)
+	if slices.Contains(s.lastPaths, path) {
+		fmt.Println("   \033[90mIt was sent with the last question.\033[0m")
+	} else {
+		fmt.Println("   \033[90mIt was not selected for the last question.\033[0m")
+	}
+}
+
+// resolvePath maps user input onto the path form used by the index
+func (s *Session) resolvePath(path string) string {
+	known := slices.Clone(s.pinned)
+	for _, idx := range s.index {
+		known = append(known, idx.Path)
+	}
+	for dropped := range s.dropped {
+		known = append(known, dropped)
+	}
+
+	// Indexed paths are root-relative; accept absolute ones too
+	path = s.scanner.relPath(path)
+	for _, candidate := range known {
+		if filepath.Clean(candidate) == path {
+			return candidate
+		}
+	}
+	return path
+}
+
+// printHistory reprints the last n questions and rendered answers of the
+// session, or all of them when arg is empty
+func (s *Session) printHistory(arg string) {
+	if len(s.turns) == 0 {
+		fmt.Println("\033[90mNo answers yet.\033[0m")
+		return
+	}
+	turns := s.turns
+	if arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			fmt.Println("\033[31m❌ Usage: /history [n]\033[0m")
+			return
+		}
+		turns = turns[max(len(turns)-n, 0):]
+	}
+
+	answers := make([]string, len(turns))
+	for i, turn := range turns {
+		answers[i] = turn.Answer
+	}
+	rendered := s.ai.renderAll(answers)
+
+	first := len(s.turns) - len(turns) + 1
+	for i, turn := range turns {
+		fmt.Println(separator())
+		fmt.Printf("\033[36m#%d %s ❯ %s\033[0m\n", first+i, turn.Time.Local().Format("15:04"), turn.Question)
+		fmt.Println(rendered[i])
+	}
+	fmt.Println(separator())
+}
+
+// appendLastAnswer appends the most recent question and answer to path
+func (s *Session) appendLastAnswer(path string) {
+	if len(s.turns) == 0 {
+		fmt.Println("\033[33m⚠️  No answer to append yet\033[0m")
+		return
+	}
+	if err := AppendAnswer(path, s.turns[len(s.turns)-1]); err != nil {
+		fmt.Printf("\033[31m❌ Could not append to %s: %v\033[0m\n", path, err)
+		return
+	}
+	fmt.Printf("\033[32m✅ Appended last answer to %s\033[0m\n", path)
+}
+
+// writeLastBlocks saves the code blocks of the last answer under dir (the
+// working directory by default)
+func (s *Session) writeLastBlocks(dir string) {
+	if len(s.turns) == 0 {
+		fmt.Println("\033[33m⚠️  No answer to write from yet\033[0m")
+		return
+	}
+	if dir == "" {
+		dir = "."
+	}
+	blocks := ExtractCodeBlocks(s.turns[len(s.turns)-1].Answer)
+	if len(blocks) == 0 {
+		fmt.Println("\033[33m⚠️  The last answer has no code blocks\033[0m")
+		return
+	}
+
+	written, err := WriteCodeBlocks(dir, blocks)
+	for _, path := range written {
+		fmt.Printf("\033[32m✅ Wrote %s\033[0m\n", path)
+	}
+	if err != nil {
+		fmt.Printf("\033[31m❌ %v\033[0m\n", err)
+	}
+}
+
+// tagTurn records a category for the next turn, or for the previous one with
+// "-last". Tags are lowercased and saved with the transcript.
+func (s *Session) tagTurn(arg string) {
+	last := false
+	if rest, ok := strings.CutPrefix(arg, "-last"); ok && (rest == "" || rest[0] == ' ') {
+		last = true
+		arg = strings.TrimSpace(rest)
+	}
+	tag := strings.ToLower(strings.Join(strings.Fields(arg), "-"))
+	if tag == "" {
+		if len(s.pendingTags) > 0 {
+			fmt.Printf("\033[36m🏷️  Next answer will be tagged: %s\033[0m\n", strings.Join(s.pendingTags, ", "))
+		} else {
+			fmt.Println("\033[31m❌ Usage: /tag [-last] <category>\033[0m")
+		}
+		return
+	}
+
+	if !last {
+		if !slices.Contains(s.pendingTags, tag) {
+			s.pendingTags = append(s.pendingTags, tag)
+		}
+		fmt.Printf("\033[32m🏷️  The next answer will be tagged '%s'\033[0m\n", tag)
+		return
+	}
+
+	if len(s.turns) == 0 {
+		fmt.Println("\033[33m⚠️  No answer to tag yet\033[0m")
+		return
+	}
+	turn := &s.turns[len(s.turns)-1]
+	if !slices.Contains(turn.Tags, tag) {
+		turn.Tags = append(turn.Tags, tag)
+	}
+	s.persist()
+	fmt.Printf("\033[32m🏷️  Tagged the last answer '%s'\033[0m\n", tag)
+}
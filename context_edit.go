@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MAX_UNDO is how many context edits /undo can walk back
+const MAX_UNDO = 20
+
+// contextSnapshot is the live context before an edit, kept for /undo
+type contextSnapshot struct {
+	label   string
+	index   []FileIndex
+	pinned  []string
+	dropped map[string]bool
+	scanned map[string]fileStamp
+}
+
+// pushUndo records the current context under label before it is modified
+func (s *Session) pushUndo(label string) {
+	dropped := make(map[string]bool, len(s.dropped))
+	for path := range s.dropped {
+		dropped[path] = true
+	}
+
+	s.undo = append(s.undo, contextSnapshot{
+		label:   label,
+		index:   slices.Clone(s.index),
+		pinned:  slices.Clone(s.pinned),
+		dropped: dropped,
+		scanned: maps.Clone(s.scanned),
+	})
+	if len(s.undo) > MAX_UNDO {
+		s.undo = s.undo[len(s.undo)-MAX_UNDO:]
+	}
+}
+
+// undoLast restores the context as it was before the last /add, /drop or /rescan
+func (s *Session) undoLast() {
+	if len(s.undo) == 0 {
+		fmt.Println("\033[33m⚠️  Nothing to undo\033[0m")
+		return
+	}
+
+	last := s.undo[len(s.undo)-1]
+	s.undo = s.undo[:len(s.undo)-1]
+	s.index = last.index
+	s.pinned = last.pinned
+	s.dropped = last.dropped
+	s.scanned = last.scanned
+	fmt.Printf("\033[32m↩️  Undid %s\033[0m\n", last.label)
+}
+
+// matchPaths returns the indexed files matching pattern, by full path, path
+// relative to the scan root or base name. For /add it also looks on disk so
+// files outside the scan filters can be pinned explicitly.
+func (s *Session) matchPaths(pattern string, includeDisk bool) []string {
+	var matches []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			matches = append(matches, path)
+		}
+	}
+
+	for _, idx := range s.index {
+		if s.pathMatches(pattern, idx.Path) {
+			add(idx.Path)
+		}
+	}
+
+	if includeDisk && len(matches) == 0 {
+		for _, glob := range []string{pattern, filepath.Join(s.scanner.Root, pattern)} {
+			found, _ := filepath.Glob(glob)
+			for _, path := range found {
+				if info, err := os.Stat(path); err == nil && !info.IsDir() {
+					if abs, err := filepath.Abs(path); err == nil {
+						path = abs
+					}
+					add(s.scanner.relPath(path))
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// pathMatches reports whether pattern matches path by path relative to the
+// scan root, absolute path or base name
+func (s *Session) pathMatches(pattern string, path string) bool {
+	for _, candidate := range []string{path, s.scanner.absPath(path), filepath.Base(path)} {
+		if ok, _ := filepath.Match(pattern, candidate); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// addToContext pins files so they are sent with every question
+func (s *Session) addToContext(pattern string) {
+	matches := s.matchPaths(pattern, true)
+	if len(matches) == 0 {
+		fmt.Printf("\033[33m⚠️  No files match %s\033[0m\n", pattern)
+		return
+	}
+	// Files found on disk never went through the walk's size check
+	matches = slices.DeleteFunc(matches, func(path string) bool {
+		info, err := os.Stat(s.scanner.absPath(path))
+		if err != nil || info.Size() <= MAX_SANE_FILE_SIZE {
+			return false
+		}
+		fmt.Printf("\033[33m⚠️  %s skipped (too large, over %d MB)\033[0m\n", path, MAX_SANE_FILE_SIZE/(1024*1024))
+		return true
+	})
+	if len(matches) == 0 {
+		return
+	}
+
+	s.pushUndo("/add " + pattern)
+	for _, path := range matches {
+		delete(s.dropped, path)
+		if !slices.Contains(s.pinned, path) {
+			s.pinned = append(s.pinned, path)
+		}
+		fmt.Printf("   \033[32m+ %s\033[0m\n", path)
+	}
+	fmt.Printf("\033[32m📌 %d files pinned to the context\033[0m\n", len(matches))
+}
+
+// dropFromContext removes files from the index and the pinned set
+func (s *Session) dropFromContext(pattern string) {
+	matches := s.matchPaths(pattern, false)
+	for _, path := range s.pinned {
+		if ok, _ := filepath.Match(pattern, path); ok && !slices.Contains(matches, path) {
+			matches = append(matches, path)
+		}
+	}
+	if len(matches) == 0 {
+		fmt.Printf("\033[33m⚠️  No files in the context match %s\033[0m\n", pattern)
+		return
+	}
+
+	s.pushUndo("/drop " + pattern)
+	for _, path := range matches {
+		s.dropped[path] = true
+		fmt.Printf("   \033[31m- %s\033[0m\n", path)
+	}
+	s.pinned = slices.DeleteFunc(s.pinned, func(path string) bool { return s.dropped[path] })
+	s.index = slices.DeleteFunc(s.index, func(idx FileIndex) bool { return s.dropped[idx.Path] })
+	fmt.Printf("\033[32m🗑️  %d files dropped from the context\033[0m\n", len(matches))
+}
+
+// rescan rebuilds the index from disk, keeping pins and manual drops, and
+// reports whether it succeeded
+func (s *Session) rescan() bool {
+	fmt.Printf("\033[36m📂 Rescanning %s...\033[0m\n", s.scanner.Root)
+	index, err := s.scanner.BuildIndex()
+	if err != nil && index == nil {
+		fmt.Printf("\033[31m❌ Rescan failed: %v\033[0m\n", err)
+		return false
+	}
+
+	s.pushUndo("/rescan")
+	s.index = slices.DeleteFunc(index, func(idx FileIndex) bool { return s.dropped[idx.Path] })
+	s.scanned = s.indexStamps()
+	fmt.Printf("\033[32m✅ Indexed %d files (~%d tokens if all were sent)\033[0m\n", len(s.index), indexTokens(s.index))
+	printScanStats(s.scanner.Stats, s.scanner.Root, s.scanner.MaxFilesPerDir)
+	if s.rag != nil {
+		if err := s.updateRetrieval(context.Background()); err != nil {
+			fmt.Printf("\033[33m⚠️  Cannot update the -rag embeddings, using the previous ones: %v\033[0m\n", err)
+		}
+	}
+	return true
+}
+
+// fileStamp is what /reload compares to tell whether a file changed on disk
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// indexStamps returns the size and modification time of every indexed file
+func (s *Session) indexStamps() map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(s.index))
+	for _, idx := range s.index {
+		if size, modTime, err := s.scanner.fileStamp(idx.Path); err == nil {
+			stamps[idx.Path] = fileStamp{size: size, modTime: modTime}
+		}
+	}
+	return stamps
+}
+
+// reload rescans the root and lists the files that were added, changed or
+// deleted on disk since the last scan; changed files are read fresh for the
+// next question
+func (s *Session) reload() {
+	before := s.scanned
+	if !s.rescan() {
+		return
+	}
+
+	var added, changed, removed []string
+	for path, stamp := range s.scanned {
+		old, ok := before[path]
+		switch {
+		case !ok:
+			added = append(added, path)
+		case old.size != stamp.size || !old.modTime.Equal(stamp.modTime):
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := s.scanned[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+	if len(added)+len(changed)+len(removed) == 0 {
+		fmt.Println("\033[90mNo files changed since the last scan.\033[0m")
+		return
+	}
+
+	slices.Sort(added)
+	slices.Sort(changed)
+	slices.Sort(removed)
+	for _, path := range added {
+		fmt.Printf("   \033[32m+ %s\033[0m\n", path)
+	}
+	for _, path := range changed {
+		fmt.Printf("   \033[33m~ %s\033[0m\n", path)
+	}
+	for _, path := range removed {
+		fmt.Printf("   \033[31m- %s\033[0m\n", path)
+	}
+	fmt.Printf("\033[32m🔄 %d new, %d changed, %d deleted\033[0m\n", len(added), len(changed), len(removed))
+}
+
+// listFiles prints the pinned and indexed files matching pattern (all when
+// empty) with their estimated size, marking those sent with the last question
+func (s *Session) listFiles(pattern string) {
+	sizes := make(map[string]int64, len(s.index))
+	for _, idx := range s.index {
+		sizes[idx.Path] = idx.Size
+	}
+
+	var shown, tokens int
+	for _, path := range s.indexPaths() {
+		if pattern != "" && !s.pathMatches(pattern, path) {
+			continue
+		}
+		size, ok := sizes[path]
+		if !ok {
+			size = fileSize(s.scanner.absPath(path))
+		}
+		fileTokens := int((size + CHARS_PER_TOKEN - 1) / CHARS_PER_TOKEN)
+
+		var marks []string
+		if slices.Contains(s.pinned, path) {
+			marks = append(marks, "📌 pinned")
+		}
+		if slices.Contains(s.lastPaths, path) {
+			marks = append(marks, "sent last")
+		}
+		if s.focused(path) {
+			marks = append(marks, "🎯 focus")
+		}
+		note := ""
+		if len(marks) > 0 {
+			note = " \033[36m" + strings.Join(marks, ", ") + "\033[0m"
+		}
+		fmt.Printf("   %s \033[90m~%d tokens\033[0m%s\n", path, fileTokens, note)
+		shown++
+		tokens += fileTokens
+	}
+
+	if shown == 0 {
+		if pattern != "" {
+			fmt.Printf("\033[33m⚠️  No files in the context match %s\033[0m\n", pattern)
+		} else {
+			fmt.Println("\033[33m⚠️  No files in the context\033[0m")
+		}
+		return
+	}
+	fmt.Printf("\033[32m📁 %d files, %d pinned, ~%d tokens if all were sent\033[0m\n", shown, len(s.pinned), tokens)
+	if len(s.dropped) > 0 {
+		fmt.Printf("\033[90m%d files removed with /drop are not listed.\033[0m\n", len(s.dropped))
+	}
+}
+
+// printTokens estimates what the next question will cost before its own
+// files are added: the system prompt with the files already sent, the
+// retained history, pinned files and pending /run output
+func (s *Session) printTokens() {
+	system, codebase, history := s.ai.conversationTokens()
+
+	var pinned int
+	for _, path := range s.pinned {
+		pinned += int((fileSize(s.scanner.absPath(path)) + CHARS_PER_TOKEN - 1) / CHARS_PER_TOKEN)
+	}
+	attached := EstimateTokens(strings.Join(s.attached, ""))
+
+	fmt.Println("\033[36m🔢 Estimated context size:\033[0m")
+	fmt.Printf("   \033[90mSystem prompt\033[0m        ~%d tokens\n", system)
+	fmt.Printf("   \033[90mFiles already sent\033[0m   ~%d tokens\n", codebase)
+	fmt.Printf("   \033[90mHistory\033[0m              ~%d tokens (%d exchanges)\n", history, len(s.ai.History)/2)
+	fmt.Printf("   \033[90mPinned files\033[0m         ~%d tokens (%d files)\n", pinned, len(s.pinned))
+	if attached > 0 {
+		fmt.Printf("   \033[90m/run output\033[0m          ~%d tokens\n", attached)
+	}
+	fmt.Printf("\033[32m   Total:                ~%d tokens\033[0m\n", system+codebase+history+pinned+attached)
+	if s.lastBudget.Tokens > 0 {
+		fmt.Printf("\033[90mThe last question's files took ~%d tokens; the whole index is ~%d.\033[0m\n", s.lastBudget.Tokens, indexTokens(s.index))
+	} else {
+		fmt.Printf("\033[90mThe whole index is ~%d tokens if all files were sent.\033[0m\n", indexTokens(s.index))
+	}
+}
+
+// contextPaths puts the pinned files ahead of the ones selected for a question
+func (s *Session) contextPaths(selected []string) []string {
+	paths := slices.Clone(s.pinned)
+	for _, path := range selected {
+		if !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// setFocus adds a /focus pattern, or lists the current ones when pattern is empty
+func (s *Session) setFocus(pattern string) {
+	switch pattern {
+	case "":
+		if len(s.focus) == 0 {
+			fmt.Println("\033[90mNo focus patterns set. Usage: /focus <glob>, /focus clear\033[0m")
+			return
+		}
+		fmt.Println("\033[36m🎯 Focus patterns:\033[0m")
+		for _, p := range s.focus {
+			fmt.Printf("   - %s\n", p)
+		}
+		return
+	case "clear":
+		s.focus = nil
+		fmt.Println("\033[32m✅ Focus cleared\033[0m")
+		return
+	}
+
+	if !slices.Contains(s.focus, pattern) {
+		s.focus = append(s.focus, pattern)
+	}
+
+	var focused []string
+	for _, path := range s.contextPaths(nil) {
+		if s.pathMatches(pattern, path) {
+			focused = append(focused, path)
+		}
+	}
+	for _, idx := range s.index {
+		if s.pathMatches(pattern, idx.Path) && !slices.Contains(focused, idx.Path) {
+			focused = append(focused, idx.Path)
+		}
+	}
+
+	fmt.Printf("\033[32m🎯 Focusing on %s (%d files)\033[0m\n", pattern, len(focused))
+	for _, path := range focused {
+		fmt.Printf("   - %s\n", path)
+	}
+	fmt.Println("\033[90mFocused files get extra attention whenever they are part of the context.\033[0m")
+}
+
+// focused reports whether path matches a /focus pattern
+func (s *Session) focused(path string) bool {
+	return slices.ContainsFunc(s.focus, func(p string) bool { return s.pathMatches(p, path) })
+}
+
+// applyFocus moves the files matching a /focus pattern to the top, keeping
+// the relative order of both groups, and returns the focused ones
+func (s *Session) applyFocus(paths []string) ([]string, []string) {
+	if len(s.focus) == 0 {
+		return paths, nil
+	}
+
+	var focused, rest []string
+	for _, path := range paths {
+		if s.focused(path) {
+			focused = append(focused, path)
+		} else {
+			rest = append(rest, path)
+		}
+	}
+	return append(focused, rest...), focused
+}
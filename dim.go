@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DIM_HEAD_LINES is how many leading lines a dimmed file keeps verbatim
+const DIM_HEAD_LINES = 15
+
+// DIM_MAX_SIGNATURES caps the declaration lines listed for one dimmed file
+const DIM_MAX_SIGNATURES = 150
+
+// declarationLine matches lines that introduce a function, type or table in
+// the languages viber scans
+var declarationLine = regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:pub(?:\(\w+\))?\s+)?(?:async\s+)?(?:func|type|interface|class|struct|enum|function|def|fn|impl|trait|mod|CREATE\s+(?:TABLE|INDEX|VIEW|FUNCTION))\b`)
+
+// DimContent reduces a large file to its first lines plus its declaration
+// lines, under a note telling the model the file is only there to skim
+func DimContent(content string, tokens int) string {
+	lines := strings.Split(content, "\n")
+	head := lines[:min(len(lines), DIM_HEAD_LINES)]
+
+	signatures := declarations(lines, len(head))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[viber] Large file (~%d tokens, %d lines), dimmed: only the first %d lines and its declarations are shown. Treat it as low priority and skim it.\n\n", tokens, len(lines), len(head))
+	b.WriteString(strings.Join(head, "\n"))
+	if len(signatures) > 0 {
+		b.WriteString("\n\n[viber] Declarations (line: signature):\n")
+		b.WriteString(strings.Join(signatures, "\n"))
+	}
+	return b.String()
+}
+
+// declarations returns the declaration lines from lines[skip:] as
+// "line: signature", at most DIM_MAX_SIGNATURES of them
+func declarations(lines []string, skip int) []string {
+	var signatures []string
+	for i := skip; i < len(lines) && len(signatures) < DIM_MAX_SIGNATURES; i++ {
+		if declarationLine.MatchString(lines[i]) {
+			signatures = append(signatures, fmt.Sprintf("%d: %s", i+1, strings.TrimRight(lines[i], " \t{")))
+		}
+	}
+	return signatures
+}
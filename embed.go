@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Values of -embed
+const (
+	EMBED_ANSWER   = "answer"
+	EMBED_QUESTION = "question"
+	EMBED_BOTH     = "both"
+)
+
+// DEFAULT_EMBED_MODEL is used by -embed unless -embed-model says otherwise
+const DEFAULT_EMBED_MODEL = "nomic-embed-text"
+
+// EMBED_CHUNK_TOKENS is the target size of each embedded answer chunk, well
+// under the input limit of common embedding models
+const EMBED_CHUNK_TOKENS = 512
+
+// EmbeddedChunk is one piece of an answer with its vector
+type EmbeddedChunk struct {
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// Embeddings are the vectors returned with an answer in -serve mode
+type Embeddings struct {
+	Model    string          `json:"model"`
+	Question []float32       `json:"question,omitempty"`
+	Answer   []EmbeddedChunk `json:"answer,omitempty"`
+}
+
+// Embedder computes the embeddings selected by -embed
+type Embedder struct {
+	provider Provider
+	Model    string
+	What     string // EMBED_ANSWER, EMBED_QUESTION or EMBED_BOTH
+}
+
+// Embed vectorizes the question and/or the answer, the latter split into
+// chunks of about EMBED_CHUNK_TOKENS, in a single embeddings request
+func (e *Embedder) Embed(ctx context.Context, question string, answer string) (*Embeddings, error) {
+	var inputs []string
+	if e.What != EMBED_ANSWER {
+		inputs = append(inputs, question)
+	}
+	var chunks []string
+	if e.What != EMBED_QUESTION && answer != "" {
+		chunks = SplitContent(answer, EMBED_CHUNK_TOKENS)
+		inputs = append(inputs, chunks...)
+	}
+
+	vectors, err := e.vectors(ctx, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := &Embeddings{Model: e.Model}
+	if e.What != EMBED_ANSWER {
+		embeddings.Question, vectors = vectors[0], vectors[1:]
+	}
+	for i, chunk := range chunks {
+		embeddings.Answer = append(embeddings.Answer, EmbeddedChunk{Text: chunk, Embedding: vectors[i]})
+	}
+	return embeddings, nil
+}
+
+// vectors embeds inputs in one request, one vector per input in order
+func (e *Embedder) vectors(ctx context.Context, inputs []string) ([][]float32, error) {
+	vectors, err := e.provider.Embed(ctx, e.Model, inputs)
+	if err != nil {
+		return nil, fmt.Errorf("embedding with %s: %w", e.Model, err)
+	}
+	if len(vectors) != len(inputs) {
+		return nil, fmt.Errorf("embedding with %s: got %d vectors for %d inputs", e.Model, len(vectors), len(inputs))
+	}
+	return vectors, nil
+}
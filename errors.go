@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrScanRoot means the scan root itself could not be walked
+	ErrScanRoot = errors.New("cannot scan root directory")
+	// ErrNoFilesMatched means the walk finished without any file passing the filters
+	ErrNoFilesMatched = errors.New("no files matched the scan filters")
+	// ErrValidationFailed means no answer passed -validate within -retries
+	ErrValidationFailed = errors.New("answer failed validation")
+)
+
+// ReadError is a single file that passed the filters but could not be read
+type ReadError struct {
+	Path string
+	Err  error
+}
+
+func (e ReadError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e ReadError) Unwrap() error {
+	return e.Err
+}
+
+// MultiReadError aggregates the per-file read failures of a scan. The files
+// that could be read were still delivered, so callers may treat it as a warning.
+type MultiReadError struct {
+	Errors []ReadError
+}
+
+func (e *MultiReadError) Error() string {
+	if len(e.Errors) == 1 {
+		return fmt.Sprintf("1 file could not be read: %v", e.Errors[0])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d files could not be read", len(e.Errors))
+	for _, re := range e.Errors {
+		fmt.Fprintf(&b, "\n  %v", re)
+	}
+	return b.String()
+}
+
+func (e *MultiReadError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, re := range e.Errors {
+		errs[i] = re
+	}
+	return errs
+}
+
+// scanResult turns the outcome of a walk into the typed scanner errors
+func scanResult(walkErr error, matched int, readErrs []ReadError) error {
+	if walkErr != nil {
+		return walkErr
+	}
+	if len(readErrs) > 0 {
+		return &MultiReadError{Errors: readErrs}
+	}
+	if matched == 0 {
+		return ErrNoFilesMatched
+	}
+	return nil
+}
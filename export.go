@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExportContext scans every file and writes a self-contained bundle meant for
+// pasting into a web chat UI: a short explanatory header with the repository
+// name, timestamp and file count, followed by the FILE blocks (in path order
+// unless -context-order says otherwise).
+// It returns the number of exported files; a *MultiReadError is returned
+// alongside a successful export when some files could not be read.
+func ExportContext(scanner *FileScanner, outPath string) (int, error) {
+	files, err := scanner.Scan(scanner.workerCount())
+	var readErr *MultiReadError
+	if err != nil && !errors.As(err, &readErr) {
+		return 0, err
+	}
+
+	files = OrderFiles(scanner.ContextOrder, scanner.Root, files, nil)
+	files, budget := FitBudget(SplitFiles(files, scanner.SplitTokens), scanner.MaxContext, nil)
+	printBudgetReport(budget)
+	exported := 0
+	for i, fc := range files {
+		if i == 0 || files[i-1].Path != fc.Path { // parts of a file are adjacent
+			exported++
+		}
+	}
+
+	repoName := scanner.Root
+	if abs, err := filepath.Abs(scanner.Root); err == nil {
+		repoName = filepath.Base(abs)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Codebase Export: %s\n\n", repoName)
+	b.WriteString("This file is a plain-text dump of a source code repository, generated by VIBER.\n")
+	b.WriteString("Each file starts with a `--- FILE: <path> ---` line followed by its full content.\n")
+	b.WriteString("Use it as the codebase context for the questions that follow.\n\n")
+	fmt.Fprintf(&b, "- Repository: %s\n", repoName)
+	fmt.Fprintf(&b, "- Generated: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Files: %d\n", exported)
+
+	for _, fc := range files {
+		b.WriteString(formatFileBlock(fc.label(blockHeader(scanner.DisplayPath(fc.Path), fc.Role)), fc.Content))
+	}
+
+	if err := os.WriteFile(outPath, []byte(b.String()), 0644); err != nil {
+		return 0, err
+	}
+	if readErr != nil {
+		return exported, readErr
+	}
+	return exported, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// runGit runs a git command inside root and returns its trimmed stdout
+func runGit(root string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", root}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimPrefix(msg, "fatal: "))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// GitLog returns the last n commits with their changed-file stats
+func GitLog(root string, n int) (string, error) {
+	return runGit(root, "log", "--oneline", "--stat", "-"+strconv.Itoa(n))
+}
+
+// GitDiff returns the uncommitted changes, staged or not, against HEAD
+func GitDiff(root string) (string, error) {
+	return runGit(root, "diff", "HEAD")
+}
+
+// GIT_MAX_BLOCK_TOKENS caps one attached diff or commit log; the rest is cut
+const GIT_MAX_BLOCK_TOKENS = 20000
+
+// diffArgs are the git diff arguments for /diff [rev], /staged, -diff and -staged
+func diffArgs(staged bool, rev string) []string {
+	args := []string{"diff"}
+	if staged {
+		args = append(args, "--staged")
+	}
+	if rev != "" {
+		args = append(args, rev, "--") // "--": a typo is a bad revision, not a missing path
+	}
+	return args
+}
+
+// diffLabel names a diff block: the unstaged or staged changes, or the
+// changes since rev
+func diffLabel(staged bool, rev string) string {
+	switch {
+	case staged:
+		return "diff --staged (staged changes)"
+	case rev != "":
+		return "diff " + rev + " (changes since " + rev + ")"
+	default:
+		return "diff (unstaged changes)"
+	}
+}
+
+// GitSince returns the commits after since with their patches. since is a
+// revision (HEAD~5, v1.2.0, main) or, when it names none, a date git
+// understands ("2 days ago", "2024-05-01").
+func GitSince(root string, since string) (string, error) {
+	if _, err := runGit(root, "rev-parse", "--verify", "--quiet", since+"^{commit}"); err == nil {
+		return runGit(root, "log", "--stat", "--patch", since+"..HEAD")
+	}
+	return runGit(root, "log", "--stat", "--patch", "--since="+since)
+}
+
+// gitBlock is formatGitBlock with output cut to GIT_MAX_BLOCK_TOKENS
+func gitBlock(label string, output string) string {
+	if limit := GIT_MAX_BLOCK_TOKENS * CHARS_PER_TOKEN; len(output) > limit {
+		cut := output[:limit]
+		if nl := strings.LastIndexByte(cut, '\n'); nl > 0 {
+			cut = cut[:nl]
+		}
+		output = fmt.Sprintf("%s\n... [%d more lines cut]", cut, strings.Count(output[len(cut):], "\n"))
+	}
+	return formatGitBlock(label, output)
+}
+
+// attachDiff lists the files in a /diff or /staged diff and attaches it to
+// the next question
+func (s *Session) attachDiff(staged bool, rev string) {
+	args := diffArgs(staged, rev)
+	diff, err := runGit(s.scanner.Root, args...)
+	if err != nil {
+		fmt.Printf("\033[31m❌ Cannot read the git diff: %v\033[0m\n", err)
+		return
+	}
+	label := diffLabel(staged, rev)
+	if diff == "" {
+		fmt.Printf("\033[33m⚠️  Nothing to attach: no changes in %s\033[0m\n", label)
+		return
+	}
+
+	if stat, err := runGit(s.scanner.Root, append([]string{"diff", "--stat"}, args[1:]...)...); err == nil {
+		for _, line := range strings.Split(stat, "\n") {
+			fmt.Printf("   \033[90m%s\033[0m\n", strings.TrimSpace(line))
+		}
+	}
+	s.attached = append(s.attached, gitBlock(label, diff))
+	fmt.Printf("\033[32m📎 git %s attached to the next question, ~%d tokens\033[0m\n", label, min(EstimateTokens(diff), GIT_MAX_BLOCK_TOKENS))
+}
+
+// formatGitBlock renders git output as a labeled context block
+func formatGitBlock(label string, output string) string {
+	return fmt.Sprintf("\n--- GIT: %s ---\n%s\n", label, output)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// IgnoreRule is one line of a .gitignore or .viberignore file, or one
+// -exclude or -include pattern
+type IgnoreRule struct {
+	Pattern  string // The line as written, for reporting
+	Source   string // "sub/.gitignore", "-exclude" or "-include"; "" for the root ignore files
+	base     string // Directory of a nested ignore file, relative to the root; the rule only applies below it
+	glob     string // Pattern without "!", the leading "/" and the trailing "/"
+	negate   bool   // "!pattern" re-includes what earlier rules ignored
+	dirOnly  bool   // "pattern/" only matches directories
+	anchored bool   // Contains a "/": matched against the path from the root, not any name
+}
+
+// parseIgnoreRule reads a gitignore line; blank lines and comments give false
+func parseIgnoreRule(line string) (IgnoreRule, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return IgnoreRule{}, false
+	}
+	rule := IgnoreRule{Pattern: line}
+	glob := line
+	if strings.HasPrefix(glob, "!") {
+		rule.negate = true
+		glob = glob[1:]
+	} else if strings.HasPrefix(glob, `\!`) || strings.HasPrefix(glob, `\#`) {
+		glob = glob[1:]
+	}
+	if strings.HasSuffix(glob, "/") {
+		rule.dirOnly = true
+		glob = strings.TrimRight(glob, "/")
+	}
+	rule.anchored = strings.Contains(glob, "/")
+	rule.glob = strings.TrimPrefix(glob, "/")
+	if rule.glob == "" {
+		return IgnoreRule{}, false
+	}
+	return rule, true
+}
+
+// Label names the rule in IgnoreHits and reports
+func (r IgnoreRule) Label() string {
+	if r.Source == "" {
+		return r.Pattern
+	}
+	return r.Pattern + " (" + r.Source + ")"
+}
+
+// matches reports whether the rule applies to rel, a slash-separated path
+// relative to the scan root. Rules of a nested ignore file match paths
+// relative to its directory, as in git.
+func (r IgnoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		var ok bool
+		if rel, ok = strings.CutPrefix(rel, r.base+"/"); !ok {
+			return false
+		}
+	}
+	if !r.anchored {
+		matched, _ := path.Match(r.glob, path.Base(rel))
+		return matched
+	}
+	return matchSegments(strings.Split(r.glob, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches a glob split on "/" against path segments, where
+// "**" stands for any number of directories ("a/**" needs at least one)
+func matchSegments(glob []string, segments []string) bool {
+	if len(glob) == 0 {
+		return len(segments) == 0
+	}
+	if glob[0] == "**" {
+		if len(glob) == 1 {
+			return len(segments) > 0
+		}
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(glob[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(glob[0], segments[0]); !matched {
+		return false
+	}
+	return matchSegments(glob[1:], segments[1:])
+}
+
+// couldMatchBelow reports whether a glob split on "/" can match a path
+// inside the directory with the given segments
+func couldMatchBelow(glob []string, segments []string) bool {
+	if len(segments) == 0 || len(glob) == 0 || glob[0] == "**" {
+		return true
+	}
+	if matched, _ := path.Match(glob[0], segments[0]); !matched {
+		return false
+	}
+	return couldMatchBelow(glob[1:], segments[1:])
+}
+
+// ignoredPath applies the rules to one path relative to the root: the root
+// ignore files, then nested ones (deeper files last), then -exclude, the
+// last matching rule winning as in git. An -include rule matching the path
+// or one of its directories overrides them all. It returns the deciding
+// rule's label.
+func (s *FileScanner) ignoredPath(rel string, isDir bool) (string, bool) {
+	rel = strings.Trim(path.Clean(strings.ReplaceAll(rel, `\`, "/")), "/")
+	if label, ok := s.included(rel, isDir); ok {
+		return label, false
+	}
+	label, ignored := "", false
+	for _, rules := range [][]IgnoreRule{s.Patterns, s.nested, s.Excludes} {
+		for _, rule := range rules {
+			if rule.matches(rel, isDir) {
+				label, ignored = rule.Label(), !rule.negate
+			}
+		}
+	}
+	return label, ignored
+}
+
+// included returns the -include rule matching rel or one of its directories
+func (s *FileScanner) included(rel string, isDir bool) (string, bool) {
+	if len(s.Includes) == 0 {
+		return "", false
+	}
+	rel = strings.Trim(path.Clean(strings.ReplaceAll(rel, `\`, "/")), "/")
+	segments := strings.Split(rel, "/")
+	for _, rule := range s.Includes {
+		if rule.matches(rel, isDir) {
+			return rule.Label(), true
+		}
+		for i := 1; i < len(segments); i++ {
+			if rule.matches(strings.Join(segments[:i], "/"), true) {
+				return rule.Label(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// includesBelow reports whether an -include rule with a path (one holding
+// a "/") can match inside the ignored directory rel, so the walk has to
+// enter it. Patterns without a "/" only re-include files in directories
+// that are walked anyway, like a "!" rule.
+func (s *FileScanner) includesBelow(rel string) bool {
+	segments := strings.Split(strings.ReplaceAll(rel, `\`, "/"), "/")
+	for _, rule := range s.Includes {
+		if rule.anchored && couldMatchBelow(strings.Split(rule.glob, "/"), segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIgnoreOverrides reads comma-separated gitignore patterns for -exclude
+// or -include (source)
+func ParseIgnoreOverrides(spec string, source string) ([]IgnoreRule, error) {
+	var rules []IgnoreRule
+	for _, pattern := range strings.Split(spec, ",") {
+		rule, ok := parseIgnoreRule(pattern)
+		if !ok {
+			continue
+		}
+		if _, err := path.Match(rule.glob, ""); err != nil {
+			return nil, fmt.Errorf("'%s': %w", rule.Pattern, err)
+		}
+		rule.Source = source
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// loadNestedIgnoreFiles reads the ignore files of a subdirectory met by the
+// walk; their rules apply below it
+func (s *FileScanner) loadNestedIgnoreFiles(dir string, rel string) {
+	base := filepath.ToSlash(rel)
+	for _, name := range s.ignoreNames {
+		for _, rule := range readIgnoreFile(filepath.Join(dir, name)) {
+			rule.base = base
+			rule.Source = base + "/" + name
+			s.nested = append(s.nested, rule)
+		}
+	}
+}
+
+// ignoredFile is ignoredPath for a file that the walk may never reach: it
+// also reports a parent directory excluded by a rule. Like git, a file
+// can't be re-included when its directory is ignored.
+func (s *FileScanner) ignoredFile(rel string) (string, bool) {
+	rel = strings.ReplaceAll(rel, `\`, "/")
+	segments := strings.Split(rel, "/")
+	for i := 1; i < len(segments); i++ {
+		if pattern, ignored := s.ignoredPath(strings.Join(segments[:i], "/"), true); ignored {
+			return pattern, true
+		}
+	}
+	return s.ignoredPath(rel, false)
+}
+
+// builtinLabel and excludeDirLabel name the non-.gitignore rules in IgnoreHits
+func builtinLabel(name string) string    { return name + "/ (built-in)" }
+func excludeDirLabel(glob string) string { return glob + " (-exclude-dir-glob)" }
+
+// countSkipped credits label with the scannable files under a skipped
+// directory. Without CountIgnored the directory itself is not walked and
+// only the rule is marked as used.
+func (s *FileScanner) countSkipped(label string, dir string) {
+	s.Stats.IgnoreHits[label] += 0
+	if !s.CountIgnored {
+		return
+	}
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() && s.allowedName(d.Name()) {
+			s.Stats.IgnoreHits[label]++
+		}
+		return nil
+	})
+}
+
+// printIgnoreSummary lists every ignore rule with the files it excluded, so
+// rules that never match stand out
+func printIgnoreSummary(s *FileScanner) {
+	var labels []string
+	names := make([]string, 0, len(s.IgnoredNames))
+	for name := range s.IgnoredNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		labels = append(labels, builtinLabel(name))
+	}
+	including := make(map[string]bool)
+	for _, rule := range slices.Concat(s.Patterns, s.nested, s.Excludes, s.Includes) {
+		labels = append(labels, rule.Label())
+		including[rule.Label()] = rule.negate || rule.Source == "-include"
+	}
+	for _, glob := range s.ExcludeDirs {
+		labels = append(labels, excludeDirLabel(glob))
+	}
+
+	fmt.Println("\033[36m🧹 Ignore rules:\033[0m")
+	for _, label := range labels {
+		hits, used := s.Stats.IgnoreHits[label]
+		switch {
+		case !used:
+			fmt.Printf("   \033[90m%s: 0 (never matched)\033[0m\n", label)
+		case including[label]:
+			fmt.Printf("   %s: %d re-included\n", label, hits)
+		default:
+			fmt.Printf("   %s: %d files\n", label, hits)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GO_DOC_TIMEOUT bounds one `go doc` run, which may have to load the module
+const GO_DOC_TIMEOUT = 30 * time.Second
+
+// ErrNoGoToolchain is returned by GoDoc when `go` is not on PATH
+var ErrNoGoToolchain = errors.New("go toolchain not found on PATH")
+
+// goDocCache remembers the `go doc` output (or failure) of each package
+// directory, since the API rarely changes within a session
+type goDocCache struct {
+	mu          sync.Mutex
+	docs        map[string]string
+	fails       map[string]error
+	noToolchain bool // warned once, every package is skipped
+}
+
+func newGoDocCache() *goDocCache {
+	return &goDocCache{docs: make(map[string]string), fails: make(map[string]error)}
+}
+
+// GoDoc returns the exported API documentation of the Go package in dir,
+// as printed by `go doc -all`. Commands (package main) are included.
+func GoDoc(dir string) (string, error) {
+	if _, err := exec.LookPath("go"); err != nil {
+		return "", ErrNoGoToolchain
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), GO_DOC_TIMEOUT)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", "doc", "-all", "-cmd", ".")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			first, _, _ := strings.Cut(msg, "\n")
+			return "", fmt.Errorf("go doc: %s", strings.TrimPrefix(first, "doc: "))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// goPackageDirs returns the root-relative directories of the Go source files
+// among paths, sorted. Test files and archive entries don't count.
+func goPackageDirs(paths []string) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, path := range paths {
+		if filepath.Ext(path) != ".go" || strings.HasSuffix(path, "_test.go") || strings.Contains(path, ARCHIVE_SEP) {
+			continue
+		}
+		if dir := filepath.Dir(path); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// goDocBlocks returns a GO DOC block for every package among paths and the
+// directories they cover. Packages `go doc` fails on are skipped, with one
+// warning per directory (or a single one when there is no toolchain).
+func (s *FileScanner) goDocBlocks(paths []string) (string, map[string]bool) {
+	cache := s.goDocs
+	var builder strings.Builder
+	covered := make(map[string]bool)
+	for _, dir := range goPackageDirs(paths) {
+		cache.mu.Lock()
+		if cache.noToolchain {
+			cache.mu.Unlock()
+			return "", covered
+		}
+		doc, cached := cache.docs[dir]
+		_, failed := cache.fails[dir]
+		cache.mu.Unlock()
+		if failed {
+			continue
+		}
+		if !cached {
+			// The lock is not held while `go doc` runs, so a slow package
+			// doesn't stall other questions; the first result stored wins
+			var err error
+			doc, err = GoDoc(s.absPath(dir))
+			cache.mu.Lock()
+			if err != nil {
+				if errors.Is(err, ErrNoGoToolchain) {
+					if !cache.noToolchain {
+						cache.noToolchain = true
+						fmt.Printf("\033[33m⚠️  -go-doc skipped: %v\033[0m\n", err)
+					}
+					cache.mu.Unlock()
+					return "", covered
+				}
+				if _, failed := cache.fails[dir]; !failed {
+					cache.fails[dir] = err
+					fmt.Printf("\033[33m⚠️  -go-doc skipped %s: %v\033[0m\n", s.DisplayPath(dir), err)
+				}
+				cache.mu.Unlock()
+				continue
+			}
+			cache.docs[dir] = doc
+			cache.mu.Unlock()
+		}
+		if doc == "" {
+			continue
+		}
+		covered[dir] = true
+		builder.WriteString(fmt.Sprintf("\n--- GO DOC: %s ---\n%s\n", s.DisplayPath(dir), doc))
+	}
+	return builder.String(), covered
+}
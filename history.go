@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// MAX_HISTORY_TURNS caps the question/answer exchanges resent with every
+// request unless -history-turns says otherwise
+const MAX_HISTORY_TURNS = 10
+
+// HISTORY_SUMMARY_PROMPT asks for the running summary that replaces
+// exchanges trimmed from the history with -summarize-history
+const HISTORY_SUMMARY_PROMPT = `Summarize this conversation about a codebase in at most 200 words, for your own later reference. Keep the questions asked, the conclusions reached, and any file names, identifiers and decisions mentioned. Reply with the summary only.`
+
+// contextBlocks splits an assembled context into its preamble (git log,
+// focus line, path legend) and its FILE blocks
+func contextBlocks(repoContext string) []string {
+	parts := strings.Split(repoContext, "\n--- FILE: ")
+	var blocks []string
+	if parts[0] != "" {
+		blocks = append(blocks, parts[0])
+	}
+	for _, part := range parts[1:] {
+		blocks = append(blocks, "\n--- FILE: "+part)
+	}
+	return blocks
+}
+
+// codebaseBlock is one context block carried by the system message
+type codebaseBlock struct {
+	key  string // blockKey: the file the block shows, "" for the preamble
+	text string
+	turn int // Last context the block was part of
+}
+
+// blockPart matches the "(part i/n)" and "(lines a-b)" header suffixes of
+// split files and -rag chunks, which belong to the file before them
+var blockPart = regexp.MustCompile(`( \((part \d+/\d+|lines \d+-\d+)\))+$`)
+
+// blockKey is the file a context block shows, "" for the preamble
+func blockKey(block string) string {
+	header, ok := strings.CutPrefix(block, "\n--- FILE: ")
+	if !ok {
+		return ""
+	}
+	header, _, _ = strings.Cut(header, " ---\n")
+	return blockPart.ReplaceAllString(header, "")
+}
+
+// addContext merges the blocks of repoContext into the codebase carried by
+// the system message, so follow-up questions don't resend files the model
+// already has. Blocks are keyed by file: a file sent again with other
+// content (after /reload, or other -rag chunks) replaces its old blocks.
+// With MaxContext the oldest blocks of earlier contexts are then evicted.
+func (ai *AIClient) addContext(repoContext string) {
+	ai.turn++
+	var keys []string
+	incoming := make(map[string][]string)
+	for _, block := range contextBlocks(repoContext) {
+		key := blockKey(block)
+		if _, ok := incoming[key]; !ok {
+			keys = append(keys, key)
+		}
+		incoming[key] = append(incoming[key], block)
+	}
+
+	for _, key := range keys {
+		var old []string
+		for _, block := range ai.codebase {
+			if block.key == key {
+				old = append(old, block.text)
+			}
+		}
+		if slices.Equal(old, incoming[key]) {
+			for i := range ai.codebase {
+				if ai.codebase[i].key == key {
+					ai.codebase[i].turn = ai.turn
+				}
+			}
+			continue
+		}
+		ai.codebase = slices.DeleteFunc(ai.codebase, func(block codebaseBlock) bool { return block.key == key })
+		for _, text := range incoming[key] {
+			ai.codebase = append(ai.codebase, codebaseBlock{key: key, text: text, turn: ai.turn})
+		}
+	}
+	ai.fitCodebase()
+}
+
+// fitCodebase evicts blocks of earlier contexts, oldest first, until the
+// codebase is within MaxContext. The latest context already fits its budget.
+func (ai *AIClient) fitCodebase() {
+	if ai.MaxContext <= 0 {
+		return
+	}
+	tokens := EstimateTokens(ai.codebaseText())
+	for tokens > ai.MaxContext {
+		oldest := -1
+		for i, block := range ai.codebase {
+			if block.turn < ai.turn && (oldest < 0 || block.turn < ai.codebase[oldest].turn) {
+				oldest = i
+			}
+		}
+		if oldest < 0 {
+			return
+		}
+		tokens -= EstimateTokens(ai.codebase[oldest].text)
+		ai.codebase = slices.Delete(ai.codebase, oldest, oldest+1)
+	}
+}
+
+// codebaseText is the codebase as sent in the system message
+func (ai *AIClient) codebaseText() string {
+	var b strings.Builder
+	for _, block := range ai.codebase {
+		b.WriteString(block.text)
+	}
+	return b.String()
+}
+
+// conversation returns the messages for the next question: the system
+// prompt with the codebase so far, the retained history and the question
+func (ai *AIClient) conversation(question string) []api.Message {
+	system := ai.systemPrompt()
+	if len(ai.codebase) > 0 {
+		system += "\n\nCODEBASE:\n" + ai.codebaseText()
+	}
+	if ai.summary != "" {
+		system += "\n\nEARLIER CONVERSATION (summary):\n" + ai.summary
+	}
+	messages := make([]api.Message, 0, len(ai.History)+2)
+	messages = append(messages, api.Message{Role: "system", Content: system})
+	messages = append(messages, ai.History...)
+	if reminder := ai.reminder(); reminder != "" && len(ai.codebase) > 0 {
+		question = reminder + "\n\nQUESTION: " + question
+	}
+	return append(messages, api.Message{Role: "user", Content: question})
+}
+
+// remember appends an exchange to the history, dropping the oldest ones
+// past HistoryTurns along with the codebase blocks no retained exchange was
+// sent with. With SummarizeHistory the dropped exchanges are folded into the
+// running summary first.
+func (ai *AIClient) remember(ctx context.Context, question string, answer string) {
+	ai.History = append(ai.History,
+		api.Message{Role: "user", Content: question},
+		api.Message{Role: "assistant", Content: answer},
+	)
+	oldest := ai.turn - max(ai.HistoryTurns, 0)
+	ai.codebase = slices.DeleteFunc(ai.codebase, func(block codebaseBlock) bool { return block.turn <= oldest })
+	extra := len(ai.History) - 2*max(ai.HistoryTurns, 0)
+	if extra <= 0 {
+		return
+	}
+	if ai.SummarizeHistory {
+		fmt.Println("\033[90m🧠 Summarizing earlier conversation...\033[0m")
+		if err := ai.summarize(ctx, ai.History[:extra]); err != nil {
+			fmt.Printf("\033[33m⚠️  Cannot summarize the trimmed history, dropping %d exchanges: %v\033[0m\n", extra/2, err)
+		}
+	}
+	ai.History = ai.History[extra:]
+}
+
+// summarize asks the model to merge old into the running summary
+func (ai *AIClient) summarize(ctx context.Context, old []api.Message) error {
+	var transcript strings.Builder
+	if ai.summary != "" {
+		transcript.WriteString("Summary so far:\n" + ai.summary + "\n\n")
+	}
+	for _, msg := range old {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, msg.Content)
+	}
+	completion, err := ai.chat(ctx, []api.Message{
+		{Role: "system", Content: HISTORY_SUMMARY_PROMPT},
+		{Role: "user", Content: transcript.String()},
+	}, false, nil)
+	if err != nil {
+		return err
+	}
+	if summary := strings.TrimSpace(completion.Answer); summary != "" {
+		ai.summary = summary
+	}
+	return nil
+}
+
+// conversationTokens estimates the system prompt (with the reminder and
+// history summary), the codebase blocks and the history the next request
+// carries
+func (ai *AIClient) conversationTokens() (system int, codebase int, history int) {
+	ai.termMu.Lock()
+	defer ai.termMu.Unlock()
+	system = EstimateTokens(ai.systemPrompt() + ai.reminder() + ai.summary)
+	codebase = EstimateTokens(ai.codebaseText())
+	for _, msg := range ai.History {
+		history += EstimateTokens(msg.Content)
+	}
+	return system, codebase, history
+}
+
+// ResetHistory forgets the conversation, keeping the loaded files, so the
+// next question starts fresh with its own context
+func (ai *AIClient) ResetHistory() {
+	ai.termMu.Lock()
+	defer ai.termMu.Unlock()
+	ai.History = nil
+	ai.summary = ""
+	ai.codebase = nil
+	ai.turn = 0
+}
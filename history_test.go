@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// codebaseHeaders lists the FILE headers the codebase carries, in order
+func codebaseHeaders(ai *AIClient) []string {
+	var headers []string
+	for _, block := range ai.codebase {
+		header, ok := strings.CutPrefix(block.text, "\n--- FILE: ")
+		if !ok {
+			headers = append(headers, "(preamble)")
+			continue
+		}
+		header, _, _ = strings.Cut(header, " ---\n")
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+func TestAddContextReplacesChangedFiles(t *testing.T) {
+	ai := NewAIClient(&mockProvider{}, "mock")
+	ai.addContext(formatFileBlock("a.go", "package a // v1") + formatFileBlock("b.go", "package b"))
+	ai.addContext(formatFileBlock("a.go", "package a // v1")) // unchanged: not resent
+	if got := codebaseHeaders(ai); !slices.Equal(got, []string{"a.go", "b.go"}) {
+		t.Fatalf("codebase = %q, want a.go and b.go once", got)
+	}
+
+	ai.addContext(formatFileBlock("a.go", "package a // v2")) // after /reload
+	if got := codebaseHeaders(ai); !slices.Equal(got, []string{"b.go", "a.go"}) {
+		t.Errorf("codebase = %q, want b.go and the new a.go", got)
+	}
+	text := ai.codebaseText()
+	if strings.Contains(text, "v1") || !strings.Contains(text, "v2") {
+		t.Errorf("codebase still has the old a.go:\n%s", text)
+	}
+}
+
+func TestAddContextReplacesChunksAndParts(t *testing.T) {
+	ai := NewAIClient(&mockProvider{}, "mock")
+	ai.addContext(formatFileBlock("a.go (lines 1-10)", "one") + formatFileBlock("a.go (lines 40-50)", "two"))
+	ai.addContext(formatFileBlock("a.go (lines 20-30)", "three"))
+	if got := codebaseHeaders(ai); !slices.Equal(got, []string{"a.go (lines 20-30)"}) {
+		t.Errorf("codebase = %q, want only the latest chunk of a.go", got)
+	}
+
+	ai.addContext(formatFileBlock("big.go (part 1/2)", "first") + formatFileBlock("big.go (part 2/2)", "second"))
+	ai.addContext(formatFileBlock("big.go (part 1/2)", "first"))
+	if got := codebaseHeaders(ai); !slices.Equal(got, []string{"a.go (lines 20-30)", "big.go (part 1/2)"}) {
+		t.Errorf("codebase = %q, want big.go with the parts last sent", got)
+	}
+
+	ai.addContext("Pay special attention to: a.go\n")
+	ai.addContext("Pay special attention to: big.go\n")
+	if n := strings.Count(ai.codebaseText(), "Pay special attention"); n != 1 {
+		t.Errorf("codebase has %d preambles, want the latest only", n)
+	}
+}
+
+func TestRememberTrimsCodebaseWithHistory(t *testing.T) {
+	ai := NewAIClient(&mockProvider{}, "mock")
+	ai.HistoryTurns = 2
+	for _, path := range []string{"a.go", "b.go", "c.go"} {
+		ai.addContext(formatFileBlock(path, "package x"))
+		ai.remember(context.Background(), "about "+path, "answer")
+	}
+	if got := codebaseHeaders(ai); !slices.Equal(got, []string{"b.go", "c.go"}) {
+		t.Errorf("codebase = %q, want the files of the 2 retained exchanges", got)
+	}
+	if len(ai.History) != 4 {
+		t.Errorf("History has %d messages, want 4", len(ai.History))
+	}
+
+	// A file sent again stays as long as its latest exchange
+	ai.addContext(formatFileBlock("b.go", "package x"))
+	ai.remember(context.Background(), "b again", "answer")
+	if got := codebaseHeaders(ai); !slices.Equal(got, []string{"b.go", "c.go"}) {
+		t.Errorf("codebase = %q, want b.go and c.go", got)
+	}
+}
+
+func TestAddContextKeepsCodebaseWithinMaxContext(t *testing.T) {
+	ai := NewAIClient(&mockProvider{}, "mock")
+	ai.MaxContext = 250
+	content := strings.Repeat("x", 380) // ~100 tokens a block with its header
+	for _, path := range []string{"a.go", "b.go", "c.go"} {
+		ai.addContext(formatFileBlock(path, content))
+	}
+	if got := codebaseHeaders(ai); !slices.Equal(got, []string{"b.go", "c.go"}) {
+		t.Errorf("codebase = %q, want the oldest file evicted", got)
+	}
+	if tokens := EstimateTokens(ai.codebaseText()); tokens > ai.MaxContext {
+		t.Errorf("codebase is ~%d tokens, over %d", tokens, ai.MaxContext)
+	}
+
+	// The latest context is never evicted, even alone over the budget
+	ai.addContext(formatFileBlock("d.go", strings.Repeat("x", 1200)))
+	if got := codebaseHeaders(ai); !slices.Equal(got, []string{"d.go"}) {
+		t.Errorf("codebase = %q, want only d.go", got)
+	}
+}
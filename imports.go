@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IMPORT_MARKER starts the line that replaces a collapsed import section, so
+// the model (and a reader of the output) can tell the file was edited
+const IMPORT_MARKER = "// [viber] imports collapsed:"
+
+var (
+	importSpecifier = regexp.MustCompile(`(?m)(?:from\s+|^import\s+|require\()['"]([^'"]+)['"]`)
+	scriptExts      = map[string]bool{".ts": true, ".tsx": true, ".js": true, ".jsx": true, ".mjs": true, ".cjs": true}
+)
+
+// CollapseImports replaces the leading import block of a TS/JS file with a
+// single comment listing the imported modules. Comments before the first
+// import are kept; the code after the last import is untouched. It returns
+// the new content and the estimated tokens saved (0 when nothing changed).
+func CollapseImports(path string, content string) (string, int) {
+	if !scriptExts[strings.ToLower(filepath.Ext(path))] {
+		return content, 0
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	first, end := -1, 0
+	var modules []string
+	inImport := false
+scan:
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case inImport:
+		case strings.HasPrefix(trimmed, "import ") || strings.HasPrefix(trimmed, "import{"):
+			if first < 0 {
+				first = i
+			}
+			inImport = true
+		case trimmed == "" || strings.HasPrefix(trimmed, "//"):
+			continue
+		default:
+			break scan // The first real statement ends the import section
+		}
+
+		if match := importSpecifier.FindStringSubmatch(trimmed); match != nil {
+			modules = append(modules, match[1])
+			inImport = false
+			end = i + 1
+		} else if strings.HasSuffix(trimmed, ";") {
+			inImport = false
+			end = i + 1
+		}
+	}
+	if first < 0 || end <= first {
+		return content, 0
+	}
+
+	summary := fmt.Sprintf("%s %s (%d lines)\n", IMPORT_MARKER, strings.Join(modules, ", "), end-first)
+	collapsed := strings.Join(lines[:first], "") + summary + strings.Join(lines[end:], "")
+	saved := EstimateTokens(content) - EstimateTokens(collapsed)
+	if saved <= 0 {
+		return content, 0
+	}
+	return collapsed, saved
+}
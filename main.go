@@ -4,30 +4,57 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/charmbracelet/glamour"
 	"github.com/ollama/ollama/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// DEFAULT_MODEL is used until another default is saved (see -model and /model)
 const DEFAULT_MODEL = "gemma4:31b-cloud"
 const BIG_MODEL = "deepseek-v4-pro:cloud"
 
+// Ollama endpoints AskAboutRepo can use
+const ENDPOINT_CHAT = "chat"
+const ENDPOINT_GENERATE = "generate"
+
 const CONFIG_DIR = ".ollama-interactive"
 const CONFIG_FILE = "config.json"
 
+// defaultExtensions are scanned unless -extensions says otherwise
+var defaultExtensions = []string{".svelte", ".ts", ".go", ".html", ".sql", ".yml", "justfile", ".rs"}
+
 // Config stores user preferences
 type Config struct {
-	DefaultModel string `json:"default_model"`
-	LastUsed     string `json:"last_used"`
+	DefaultModel string   `json:"default_model"`
+	LastUsed     string   `json:"last_used"`
+	CloudModels  []string `json:"cloud_models,omitempty"` // Extra models to treat as metered
+}
+
+// IsCloudModel reports whether requests to model may be metered: Ollama's
+// ":cloud" / "-cloud" tags, or a model listed in cloud_models
+func (c *Config) IsCloudModel(model string) bool {
+	if slices.Contains(c.CloudModels, model) {
+		return true
+	}
+	_, tag, ok := strings.Cut(model, ":")
+	return ok && (tag == "cloud" || strings.HasSuffix(tag, "-cloud"))
 }
 
 func GetConfigPath() (string, error) {
@@ -87,22 +114,58 @@ func SaveConfig(config *Config) error {
 	return os.WriteFile(configPath, data, 0644)
 }
 
-// ListModels fetches available models from Ollama
-func ListModels(client *api.Client) ([]string, error) {
+// ListModels fetches the available models from the provider
+func ListModels(provider Provider) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return provider.Models(ctx)
+}
+
+// PrintModelInfo shows the parameters of a model that matter when sizing the
+// context: context length, parameter size, quantization and prompt template
+func PrintModelInfo(provider Provider, model string) error {
+	ollama, ok := provider.(*OllamaProvider)
+	if !ok {
+		return fmt.Errorf("model details are only available from Ollama, not from %s", provider.Name())
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	resp, err := client.List(ctx)
+	resp, err := ollama.client.Show(ctx, &api.ShowRequest{Model: model})
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	contextLength := "unknown"
+	if arch, ok := resp.ModelInfo["general.architecture"].(string); ok {
+		if v, ok := resp.ModelInfo[arch+".context_length"]; ok {
+			contextLength = fmt.Sprint(v)
+		}
 	}
 
-	var models []string
-	for _, model := range resp.Models {
-		models = append(models, model.Name)
+	fmt.Printf("\033[36m🧠 Model: %s\033[0m\n", model)
+	fmt.Printf("   \033[90mContext length:\033[0m %s tokens\n", contextLength)
+	fmt.Printf("   \033[90mParameters:\033[0m     %s\n", valueOr(resp.Details.ParameterSize, "unknown"))
+	fmt.Printf("   \033[90mQuantization:\033[0m   %s\n", valueOr(resp.Details.QuantizationLevel, "unknown"))
+	fmt.Printf("   \033[90mFamily:\033[0m         %s\n", valueOr(resp.Details.Family, "unknown"))
+	if resp.RemoteHost != "" {
+		fmt.Printf("   \033[90mRemote host:\033[0m    %s\n", resp.RemoteHost)
+	}
+	if resp.Template != "" {
+		fmt.Println("   \033[90mTemplate:\033[0m")
+		for _, line := range strings.Split(strings.TrimRight(resp.Template, "\n"), "\n") {
+			fmt.Printf("   \033[90m│\033[0m %s\n", line)
+		}
 	}
+	return nil
+}
 
-	return models, nil
+func valueOr(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
 }
 
 // SelectModel shows interactive model selection
@@ -144,10 +207,33 @@ func SelectModel(models []string, defaultModel string) (string, error) {
 	return selected, nil
 }
 
+// AIClient is safe for concurrent use: per-request state stays local to
+// each call and the shared fields are guarded below
 type AIClient struct {
-	client   *api.Client
-	renderer *glamour.TermRenderer
-	Model    string // ← Agregar campo para el modelo seleccionado
+	provider  Provider
+	renders   *renderPool
+	RenderCmd string           // External Markdown renderer (e.g. "bat -l md"), empty = glamour
+	Endpoint  string           // ENDPOINT_CHAT (default) or ENDPOINT_GENERATE, Ollama only
+	Validator *AnswerValidator // Checks interactive answers (-validate), nil = accept anything
+	Stream    bool             // Print interactive answers as they arrive (buffered when validating)
+	History   []api.Message    // Earlier interactive questions and answers, at most HistoryTurns exchanges
+	Remind    bool             // Repeat SYSTEM_REMINDER before each question (-repeat-system-prompt)
+	Review    string           // REVIEW_TEXT or REVIEW_JSON to ask for review comments, "" = prose answers
+	System    string           // Replaces SYSTEM_PROMPT (-system-prompt), "" = built-in
+
+	HistoryTurns     int  // Exchanges kept in History (-history-turns), 0 = every question stands alone
+	SummarizeHistory bool // Fold trimmed exchanges into a summary instead of forgetting them
+	MaxContext       int  // -max-context: the oldest codebase blocks are evicted to stay within it, 0 = unlimited
+
+	mu       sync.RWMutex
+	model    string     // ← Agregar campo para el modelo seleccionado
+	termMu   sync.Mutex // one spinner and answer on the terminal at a time
+	rendered *renderCache
+
+	// Conversation state behind History, guarded by termMu
+	codebase []codebaseBlock // Context blocks sent so far, carried by the system message
+	turn     int             // Contexts added so far, to age codebase blocks with History
+	summary  string          // Running summary of exchanges trimmed from History
 }
 
 // Agrega esto en Session para permitir cambiar modelo
@@ -156,67 +242,262 @@ func (s *Session) ChangeModel(newModel string) {
 	fmt.Printf("\033[32m✅ Modelo cambiado a: %s\033[0m\n", newModel)
 }
 
-func NewAIClient(model string) (*AIClient, error) {
-	client, err := api.ClientFromEnvironment()
-	if err != nil {
-		return nil, err
-	}
-	r, _ := glamour.NewTermRenderer(
-		glamour.WithAutoStyle(),
-		glamour.WithWordWrap(100),
-	)
+func NewAIClient(provider Provider, model string) *AIClient {
 	return &AIClient{
-		client:   client,
-		renderer: r,
-		Model:    model, // ← Usar modelo pasado como parámetro
-	}, nil
+		provider: provider,
+		renders:  newRenderPool(0),
+		model:    model, // ← Usar modelo pasado como parámetro
+		rendered: newRenderCache(),
+
+		HistoryTurns: MAX_HISTORY_TURNS,
+	}
 }
 
 // UpdateModel allows changing the model during session
 func (ai *AIClient) UpdateModel(model string) {
-	ai.Model = model
+	ai.mu.Lock()
+	ai.model = model
+	ai.mu.Unlock()
 }
 
-func (ai *AIClient) AskAboutRepo(ctx context.Context, repoContext string, userQuestion string) error {
+// Model returns the model used for new requests
+func (ai *AIClient) Model() string {
+	ai.mu.RLock()
+	defer ai.mu.RUnlock()
+	return ai.model
+}
+
+// AskAboutRepo prints the rendered answer and returns the completion with
+// the raw Markdown and token usage
+func (ai *AIClient) AskAboutRepo(ctx context.Context, repoContext string, userQuestion string) (Completion, error) {
+	ai.termMu.Lock()
+	defer ai.termMu.Unlock()
+
+	if ai.Stream && ai.Validator == nil {
+		return ai.askStreaming(ctx, repoContext, userQuestion)
+	}
+
+	ai.addContext(repoContext)
+	completion, attempts, err := ai.completeValidated(ctx, userQuestion)
+	if errors.Is(err, ErrValidationFailed) {
+		// Still show the last answer so the user can see what went wrong
+		fmt.Println(ai.render(completion.Answer))
+	}
+	if err != nil {
+		return Completion{}, err
+	}
+
+	if ai.Review != "" {
+		ai.printReview(completion.Answer)
+	} else {
+		fmt.Println(ai.render(completion.Answer))
+	}
+	if ai.Validator != nil && ai.Review == "" {
+		fmt.Printf("\033[32m✅ Answer passed validation (%d/%d attempts)\033[0m\n", attempts, ai.Validator.Retries+1)
+	}
+	ai.remember(ctx, userQuestion, completion.Answer)
+	return completion, nil
+}
+
+// askStreaming prints the answer block by block while it arrives; the
+// spinner only runs until the first token
+func (ai *AIClient) askStreaming(ctx context.Context, repoContext string, userQuestion string) (Completion, error) {
+	done := make(chan bool)
+	go ai.playSpinner(ctx, done)
+	var stopOnce sync.Once
+	stopSpinner := func() { stopOnce.Do(func() { done <- true }) }
+
+	ai.addContext(repoContext)
+	printer := &streamPrinter{ai: ai}
+	var received strings.Builder
+	completion, err := ai.chat(ctx, ai.conversation(userQuestion), true, func(chunk string) error {
+		stopSpinner()
+		received.WriteString(chunk)
+		printer.Write(chunk)
+		return nil
+	})
+	stopSpinner()
+	if err != nil {
+		if received.Len() > 0 {
+			printer.Finish(received.String()) // keep what arrived before the failure
+		}
+		return Completion{}, err
+	}
+	printer.Finish(completion.Answer)
+	ai.remember(ctx, userQuestion, completion.Answer)
+	return completion, nil
+}
+
+// Completion is a finished answer along with the usage reported by the provider
+type Completion struct {
+	Answer           string
+	PromptTokens     int
+	CompletionTokens int
+	Duration         time.Duration
+}
+
+// Complete sends the question with the repository context and returns the
+// raw Markdown answer without printing anything
+func (ai *AIClient) Complete(ctx context.Context, repoContext string, userQuestion string) (Completion, error) {
+	return ai.chat(ctx, buildMessages(ai.systemPrompt(), ai.reminder(), repoContext, userQuestion), false, nil)
+}
+
+// CompleteStream is Complete with streaming enabled: onChunk receives each
+// piece of the answer as it arrives. Returning an error from onChunk (or
+// canceling ctx) aborts the request.
+func (ai *AIClient) CompleteStream(ctx context.Context, repoContext string, userQuestion string, onChunk func(string) error) (Completion, error) {
+	return ai.chat(ctx, buildMessages(ai.systemPrompt(), ai.reminder(), repoContext, userQuestion), true, onChunk)
+}
+
+// SYSTEM_PROMPT opens every conversation
+const SYSTEM_PROMPT = "You are a Senior Software Engineer. Use the provided codebase to answer questions. Use Markdown for all formatting (code blocks, bold, headers)."
+
+// SYSTEM_REMINDER is the condensed SYSTEM_PROMPT repeated right before the
+// question, after a long codebase, for models that lose track of the start
+const SYSTEM_REMINDER = "Reminder: answer as a Senior Software Engineer, based on the codebase above, formatted in Markdown."
+
+// systemPrompt is SYSTEM_PROMPT or the -system-prompt replacement, and
+// REVIEW_SYSTEM_PROMPT in review mode
+func (ai *AIClient) systemPrompt() string {
+	switch {
+	case ai.Review != "":
+		return REVIEW_SYSTEM_PROMPT
+	case ai.System != "":
+		return ai.System
+	}
+	return SYSTEM_PROMPT
+}
+
+// reminder is the condensed system prompt repeated before each question
+// with -repeat-system-prompt, "" otherwise
+func (ai *AIClient) reminder() string {
+	switch {
+	case !ai.Remind:
+		return ""
+	case ai.Review != "":
+		return REVIEW_REMINDER
+	default:
+		return SYSTEM_REMINDER
+	}
+}
+
+// buildMessages assembles the system prompt and the user turn carrying the
+// codebase, with the reminder (if any) before the question
+func buildMessages(system string, reminder string, repoContext string, userQuestion string) []api.Message {
 	systemMsg := api.Message{
 		Role:    "system",
-		Content: "You are a Senior Software Engineer. Use the provided codebase to answer questions. Use Markdown for all formatting (code blocks, bold, headers).",
+		Content: system,
+	}
+	question := "QUESTION: " + userQuestion
+	if reminder != "" {
+		question = reminder + "\n\n" + question
 	}
 	userMsg := api.Message{
 		Role:    "user",
-		Content: fmt.Sprintf("CODEBASE:\n%s\n\nQUESTION: %s", repoContext, userQuestion),
+		Content: fmt.Sprintf("CODEBASE:\n%s\n\n%s", repoContext, question),
 	}
+	if repoContext == "" {
+		userMsg.Content = userQuestion
+	}
+	return []api.Message{systemMsg, userMsg}
+}
 
-	done := make(chan bool)
-	go ai.playSpinner(ctx, done)
+func (ai *AIClient) chat(ctx context.Context, messages []api.Message, stream bool, onChunk func(string) error) (Completion, error) {
+	contextBytes := 0
+	for _, msg := range messages {
+		contextBytes += len(msg.Content)
+	}
+	ctx, span := tracer.Start(ctx, "chat", trace.WithAttributes(
+		attribute.String("viber.model", ai.Model()),
+		attribute.String("viber.endpoint", ai.Endpoint),
+		attribute.Bool("viber.stream", stream),
+		attribute.Int("viber.context_bytes", contextBytes),
+		attribute.Int("viber.messages", len(messages)),
+	))
+	completion, err := ai.withLatestFallback(span, func() (Completion, error) {
+		return ai.send(ctx, messages, stream, onChunk)
+	})
+	span.SetAttributes(
+		attribute.Int("viber.prompt_tokens", completion.PromptTokens),
+		attribute.Int("viber.completion_tokens", completion.CompletionTokens),
+	)
+	endSpan(span, err)
+	return completion, err
+}
 
-	var fullResponse strings.Builder
-	req := &api.ChatRequest{
-		Model:    ai.Model, // ← Usar el modelo almacenado en la instancia
-		Messages: []api.Message{systemMsg, userMsg},
-		Stream:   new(bool),
+// withLatestFallback runs call and, when the provider reports an untagged
+// model as not found, switches to its ':latest' name and runs it once more.
+// The model is restored if the retry fails as well.
+func (ai *AIClient) withLatestFallback(span trace.Span, call func() (Completion, error)) (Completion, error) {
+	completion, err := call()
+	if tagged, ok := withLatestTag(ai.Model()); ok && isModelNotFound(err) {
+		untagged := ai.Model()
+		fmt.Printf("\r\033[K\033[33m⚠️  Model '%s' not found, retrying as '%s'\033[0m\n", untagged, tagged)
+		ai.UpdateModel(tagged)
+		span.SetAttributes(attribute.String("viber.model", tagged))
+		if completion, err = call(); err != nil {
+			ai.UpdateModel(untagged)
+		}
 	}
+	return completion, err
+}
 
-	err := ai.client.Chat(ctx, req, func(res api.ChatResponse) error {
-		fullResponse.WriteString(res.Message.Content)
-		return nil
-	})
+// send runs one request against the provider, through /api/generate when
+// -endpoint generate is used with Ollama
+func (ai *AIClient) send(ctx context.Context, messages []api.Message, stream bool, onChunk func(string) error) (Completion, error) {
+	if ollama, ok := ai.provider.(*OllamaProvider); ok && ai.Endpoint == ENDPOINT_GENERATE {
+		return ollama.Generate(ctx, ai.Model(), messages, stream, onChunk)
+	}
+	return ai.provider.Chat(ctx, ai.Model(), messages, stream, onChunk)
+}
+
+// render formats the raw Markdown answer for the terminal, using RenderCmd
+// when configured and falling back to glamour if the command fails. A code
+// block left open by a cut-off answer is closed first.
+func (ai *AIClient) render(markdown string) string {
+	markdown = CloseFences(markdown)
+	if out, ok := ai.rendered.get(markdown); ok {
+		return out
+	}
+	if ai.RenderCmd != "" {
+		release := ai.renders.acquire()
+		out, err := renderWithCommand(ai.RenderCmd, markdown)
+		release()
+		if err == nil {
+			ai.rendered.put(markdown, out)
+			return out
+		}
+		fmt.Printf("\033[33m⚠️  Render command failed (%v), using glamour\033[0m\n", err)
+	}
+	out, _ := ai.renders.render(markdown)
+	ai.rendered.put(markdown, out)
+	return out
+}
 
-	done <- true
+// renderWithCommand pipes the Markdown to the command's stdin and returns its stdout
+func renderWithCommand(command string, markdown string) (string, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty render command")
+	}
 
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stdin = strings.NewReader(markdown)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
 	if err != nil {
-		return err
+		return "", err
 	}
-
-	out, _ := ai.renderer.Render(fullResponse.String())
-	fmt.Println(out)
-	return nil
+	return string(out), nil
 }
 
 // FileContent holds the metadata and actual text of the file
 type FileContent struct {
 	Path    string
 	Content string
+	Role    string // Guessed role (e.g. "Go test"), set when AnnotateRoles is on
+	Part    int    // Position of this part of a file split by SplitFiles, 0 = whole file
+	Parts   int    // How many parts the file was split into
 }
 
 // Add this to your FileScanner
@@ -224,64 +505,588 @@ type FileIndex struct {
 	Path    string
 	Summary string // Optional: first 200 chars or function names
 	Ext     string
+	Size    int64 // Bytes on disk, 0 for archive entries
+}
+
+// indexSlot is one walked file of BuildIndex, filled in by a reader
+type indexSlot struct {
+	path  string
+	entry *FileIndex // nil when a content filter left the file out
+	err   error
 }
 
+// BuildIndex walks the tree and summarizes every matching file. Heads are
+// read by Workers goroutines; the index keeps the walk order.
 func (s *FileScanner) BuildIndex() ([]FileIndex, error) {
+	_, span := tracer.Start(context.Background(), "scan.index")
+	workers := s.workerCount()
+	slotsChan := make(chan *indexSlot, s.bufferSize(workers))
+	var wg sync.WaitGroup
+	var mu sync.Mutex // guards Stats, Checkpoint and abortErr
+	var abortErr error
+	var slots []*indexSlot
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for slot := range slotsChan {
+				s.indexFile(slot, &mu)
+				if slot.err != nil && s.AbortOnRead {
+					mu.Lock()
+					if abortErr == nil {
+						abortErr = ReadError{Path: slot.path, Err: slot.err}
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	err := s.walkFiles(func(path string) error {
+		mu.Lock()
+		aborted := abortErr
+		mu.Unlock()
+		if aborted != nil {
+			return aborted
+		}
+		slot := &indexSlot{path: path}
+		slots = append(slots, slot)
+		slotsChan <- slot
+		return nil
+	})
+	close(slotsChan)
+	wg.Wait()
+	if abortErr != nil {
+		err = abortErr
+	}
+
 	var index []FileIndex
-	err := filepath.WalkDir(s.Root, func(path string, d fs.DirEntry, err error) error {
+	var readErrs []ReadError
+	for _, slot := range slots {
+		switch {
+		case slot.err != nil && !s.AbortOnRead:
+			readErrs = append(readErrs, ReadError{Path: slot.path, Err: slot.err})
+		case slot.entry != nil:
+			index = append(index, *slot.entry)
+		}
+	}
+
+	// A finished walk doesn't need resuming; later rescans run without checkpoints
+	if s.Checkpoint != nil && err == nil {
+		s.Checkpoint.Remove()
+		s.Checkpoint = nil
+	}
+	err = scanResult(err, len(index)+len(readErrs), readErrs)
+	if s.AbortOnRead && errors.As(err, new(ReadError)) {
+		index = nil // aborted by -on-read-error abort, the index is incomplete
+	}
+	span.SetAttributes(
+		attribute.Int("viber.files", len(index)),
+		attribute.Int("viber.read_errors", len(readErrs)),
+	)
+	endSpan(span, err)
+	return index, err
+}
+
+// indexFile fills in slot with the summary of its file, from the checkpoint
+// when it is unchanged. mu guards the stats and the checkpoint.
+func (s *FileScanner) indexFile(slot *indexSlot, mu *sync.Mutex) {
+	path := slot.path
+	mu.Lock()
+	checkpoint := s.Checkpoint
+	summary, resumed := "", false
+	if checkpoint != nil {
+		summary, resumed = checkpoint.lookup(s.absPath(path))
+	}
+	if resumed {
+		s.Stats.Resumed++
+	}
+	mu.Unlock()
+	if resumed {
+		slot.entry = &FileIndex{Path: path, Summary: summary, Ext: filepath.Ext(path), Size: fileSize(s.absPath(path))}
+		return
+	}
+
+	// Read only first 500 bytes for summary (more when the content filters need them)
+	var err error
+	if s.IncludeContent != nil {
+		summary, err = s.ReadFile(path)
+	} else {
+		summary, err = s.readHead(path, max(500, s.contentSniffSize()))
+	}
+	if err != nil {
+		slot.err = err
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if isBinary(summary) {
+		s.Stats.SkippedBinary++
+		return
+	}
+	if s.excludedByContent(summary) {
+		s.Stats.ExcludedByContent++
+		return
+	}
+	if !s.includedByContent(summary) {
+		s.Stats.NotIncludedByContent++
+		return
+	}
+	summary = summary[:min(len(summary), 500)]
+	if s.Checkpoint != nil {
+		if err := s.Checkpoint.record(s.absPath(path), summary); err != nil {
+			fmt.Printf("\033[33m⚠️  Could not write scan checkpoint: %v\033[0m\n", err)
+			s.Checkpoint = nil
+		}
+	}
+	slot.entry = &FileIndex{
+		Path:    path,
+		Summary: summary,
+		Ext:     filepath.Ext(path),
+		Size:    fileSize(s.absPath(path)),
+	}
+}
+
+// fileSize is the size of path on disk, or 0 when it can't be stat'ed (archive entries)
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// readHead returns up to n bytes from the start of a file or archive entry
+func (s *FileScanner) readHead(path string, n int) (string, error) {
+	if _, _, ok := splitArchivePath(path); ok {
+		content, err := s.ReadFile(path)
+		if len(content) > n {
+			content = content[:n]
+		}
+		return content, err
+	}
+
+	f, err := os.Open(s.absPath(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, n)
+	read, _ := f.Read(buf)
+	return string(buf[:read]), nil
+}
+
+// walkFiles walks the scan root and calls fn with the root-relative path of
+// every file that passes the ignore, extension and per-directory filters.
+// Stats are reset on each walk.
+// With ScanArchives set, matching entries of .zip and .tar.gz files are
+// passed as "archive!entry" paths.
+func (s *FileScanner) walkFiles(fn func(path string) error) error {
+	s.Stats = ScanStats{CappedDirs: make(map[string]int), IgnoreHits: make(map[string]int)}
+	s.nested = nil
+	dirCounts := make(map[string]int)
+	hidden := make(map[string]string) // ignored directories walked only for -include -> their rule
+	folded := make(map[string]string) // lowercased path -> first path seen
+	linked := make(map[string]bool)   // real paths of the files links pointed to so far
+
+	return filepath.WalkDir(s.Root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
+			if path == s.Root {
+				return fmt.Errorf("%w %s: %w", ErrScanRoot, s.Root, err)
+			}
 			return err
 		}
+		rel := s.relPath(path)
 
 		// ✅ Skip ignored directories (prevents walking into them)
 		if d.IsDir() {
-			if s.IgnoredNames[d.Name()] {
-				return filepath.SkipDir
+			label, ignored := hidden[filepath.Dir(rel)], false
+			if rel != "." {
+				ignored = label != ""
+				if !ignored {
+					label, ignored = s.ignoredDir(rel, d.Name())
+				}
+				if ignored {
+					if included, ok := s.included(rel, true); ok {
+						s.Stats.IgnoreHits[included] += 0
+						ignored = false
+					}
+				}
+			}
+			if ignored {
+				if !s.includesBelow(rel) {
+					s.countSkipped(label, path)
+					return filepath.SkipDir
+				}
+				s.Stats.IgnoreHits[label] += 0
+				hidden[rel] = label // walked for -include only
+			} else if rel != "." {
+				s.loadNestedIgnoreFiles(path, rel)
+			}
+			s.Progress.SetDir(path)
+			return nil
+		}
+
+		// Links to directories are never followed; flag the ones that loop back
+		// so a cyclic tree can't trick the walk. Only links need a stat of
+		// their target, everything else has its info from the directory read.
+		var info fs.FileInfo
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Stat(path)
+			if err != nil {
+				return nil // broken link
+			}
+			if target.IsDir() {
+				if linksToAncestor(path) {
+					s.Stats.SymlinkLoops = append(s.Stats.SymlinkLoops, rel)
+				}
+				return nil
+			}
+			info = target
+		}
+
+		if s.ScanArchives && isArchive(path) {
+			if label := hidden[filepath.Dir(rel)]; label != "" {
+				if _, ok := s.included(rel, false); !ok {
+					s.Stats.IgnoreHits[label]++
+					return nil
+				}
+			} else if pattern, ignored := s.ignoredPath(rel, false); ignored {
+				s.Stats.IgnoreHits[pattern]++
+				return nil
+			}
+			for _, entry := range s.archiveEntries(path) {
+				if err := fn(entry); err != nil {
+					return err
+				}
 			}
 			return nil
 		}
 
 		// Skip disallowed extensions
-		if !s.AllowedExts[filepath.Ext(path)] {
+		if !s.allowedName(d.Name()) {
 			return nil
 		}
 
-		// Check .gitignore patterns
-		for _, p := range s.Patterns {
-			if matched, _ := filepath.Match(p, d.Name()); matched {
+		// Inside a directory walked only for -include, nothing else is taken
+		if label := hidden[filepath.Dir(rel)]; label != "" {
+			included, ok := s.included(rel, false)
+			if !ok {
+				s.Stats.IgnoreHits[label]++
+				return nil
+			}
+			s.Stats.IgnoreHits[included]++
+		} else if pattern, ignored := s.ignoredPath(rel, false); pattern != "" {
+			// .gitignore patterns (ignored directories were skipped above)
+			s.Stats.IgnoreHits[pattern]++ // a "!" rule counts the files it re-included
+			if ignored {
 				return nil
 			}
 		}
 
-		// Read only first 500 bytes for summary
-		f, err := os.Open(path)
-		if err != nil {
-			return nil
+		if info == nil {
+			info, _ = d.Info()
+		} else if real, err := filepath.EvalSymlinks(path); err == nil {
+			// Sibling links to one file would send it twice
+			if linked[real] {
+				s.Stats.SymlinkRepeats = append(s.Stats.SymlinkRepeats, rel)
+				return nil
+			}
+			linked[real] = true
+		}
+		if info != nil {
+			// Empty files only add a bare header to the context
+			if !s.IncludeEmpty && info.Size() == 0 {
+				s.Stats.SkippedEmpty++
+				return nil
+			}
+			// Safety net against stray build artifacts and data dumps
+			if info.Size() > MAX_SANE_FILE_SIZE {
+				s.Stats.SkippedTooLarge = append(s.Stats.SkippedTooLarge, rel)
+				return nil
+			}
 		}
-		defer f.Close()
 
-		buf := make([]byte, 500)
-		f.Read(buf)
-		index = append(index, FileIndex{
-			Path:    path,
-			Summary: string(buf),
-			Ext:     filepath.Ext(path),
-		})
+		// Foo.ts and foo.ts are one file on case-insensitive filesystems
+		key := strings.ToLower(rel)
+		if first, ok := folded[key]; ok {
+			s.Stats.CaseCollisions = append(s.Stats.CaseCollisions, [2]string{first, rel})
+			if s.DedupeCase {
+				return nil
+			}
+		} else {
+			folded[key] = rel
+		}
 
-		return nil
+		// WalkDir visits entries in lexical order, so this keeps the first N by name
+		if s.MaxFilesPerDir > 0 {
+			dir := filepath.Dir(rel)
+			if dirCounts[dir] >= s.MaxFilesPerDir {
+				s.Stats.CappedDirs[dir]++
+				return nil
+			}
+			dirCounts[dir]++
+		}
+
+		return fn(rel)
 	})
-	return index, err
+}
+
+// linksToAncestor reports whether the directory link at path resolves to
+// a directory enclosing it, which makes the tree cyclic if followed
+func linksToAncestor(path string) bool {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(target, parent)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ignoredDir returns the label of the built-in name, ignore rule or
+// -exclude-dir-glob that skips a root-relative directory, if any
+func (s *FileScanner) ignoredDir(rel string, name string) (string, bool) {
+	if s.IgnoredNames[name] {
+		return builtinLabel(name), true
+	}
+	if pattern, ignored := s.ignoredPath(rel, true); ignored {
+		return pattern, true
+	}
+	if glob, excluded := s.excludedDir(rel); excluded {
+		return excludeDirLabel(glob), true
+	}
+	return "", false
+}
+
+// allowedName reports whether a file name passes the extension set or one
+// of the -include-glob patterns (matched on the base name, so compound
+// suffixes like *.stories.tsx work)
+func (s *FileScanner) allowedName(name string) bool {
+	if s.AllowedExts[filepath.Ext(name)] {
+		return true
+	}
+	for _, glob := range s.IncludeGlobs {
+		if matched, _ := filepath.Match(glob, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedDir returns the -exclude-dir-glob pattern matching a root-relative
+// directory path, if any
+func (s *FileScanner) excludedDir(rel string) (string, bool) {
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for _, glob := range s.ExcludeDirs {
+		if matchSegments(strings.Split(glob, "/"), segments) {
+			return glob, true
+		}
+	}
+	return "", false
+}
+
+// Explain reports which filter of the last walk would exclude path, or that
+// it passes them all. It mirrors the checks in walkFiles.
+func (s *FileScanner) Explain(path string) string {
+	info, err := os.Stat(s.absPath(path))
+	if err != nil {
+		return "file does not exist"
+	}
+	if info.IsDir() {
+		return "is a directory"
+	}
+
+	rel := s.relPath(path)
+	if filepath.IsAbs(rel) {
+		return fmt.Sprintf("outside the scan root %s", s.Root)
+	}
+	includedBy, included := s.included(rel, false)
+	dirs := strings.Split(filepath.Dir(rel), string(filepath.Separator))
+	for i, dir := range dirs {
+		if included {
+			break // -include overrides the directory rules
+		}
+		if s.IgnoredNames[dir] {
+			return fmt.Sprintf("inside ignored directory '%s'", dir)
+		}
+		if glob, excluded := s.excludedDir(filepath.Join(dirs[:i+1]...)); excluded {
+			return fmt.Sprintf("inside directory '%s' excluded by -exclude-dir-glob '%s'", filepath.Join(dirs[:i+1]...), glob)
+		}
+	}
+
+	if ext := filepath.Ext(path); !s.allowedName(filepath.Base(path)) {
+		if len(s.IncludeGlobs) > 0 {
+			return fmt.Sprintf("extension '%s' is not in the allowed list and no -include-glob matches", ext)
+		}
+		return fmt.Sprintf("extension '%s' is not in the allowed list", ext)
+	}
+	if p, ignored := s.ignoredFile(rel); ignored && !included {
+		return fmt.Sprintf("matches ignore rule '%s'", p)
+	}
+	if !s.IncludeEmpty && info.Size() == 0 {
+		return "empty file (use -include-empty to keep it)"
+	}
+	if info.Size() > MAX_SANE_FILE_SIZE {
+		return fmt.Sprintf("skipped (too large): %d bytes exceeds the %d byte safety limit", info.Size(), MAX_SANE_FILE_SIZE)
+	}
+	if s.DedupeCase {
+		for _, pair := range s.Stats.CaseCollisions {
+			if pair[1] == rel {
+				return fmt.Sprintf("differs only by case from %s (-dedupe-case keeps the first)", pair[0])
+			}
+		}
+	}
+	if s.Stats.CappedDirs[filepath.Dir(rel)] > 0 {
+		return fmt.Sprintf("directory capped by -max-files-per-dir (%d)", s.MaxFilesPerDir)
+	}
+	if s.ExcludeContent != nil {
+		if head, err := s.readHead(path, EXCLUDE_CONTENT_SNIFF_SIZE); err == nil && s.excludedByContent(head) {
+			return fmt.Sprintf("content matches -exclude-content '%s'", s.ExcludeContent)
+		}
+	}
+	if s.IncludeContent != nil {
+		if content, err := s.ReadFile(path); err == nil && !s.includedByContent(content) {
+			return fmt.Sprintf("content doesn't match -include-content '%s'", s.IncludeContent)
+		}
+	}
+	if included {
+		return fmt.Sprintf("passes all scan filters (ignore rules overridden by %s)", includedBy)
+	}
+	return "passes all scan filters"
+}
+
+// MAX_SANE_FILE_SIZE is the hard ceiling for any single file, whatever the filters say
+const MAX_SANE_FILE_SIZE = 10 * 1024 * 1024
+
+// Values of -on-read-error
+const (
+	ON_READ_ERROR_CONTINUE = "continue"
+	ON_READ_ERROR_ABORT    = "abort"
+)
+
+// workerCount is Workers, or one reader per CPU when unset
+func (s *FileScanner) workerCount() int {
+	if s.Workers > 0 {
+		return s.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// SCAN_BUFFER_PER_WORKER sizes the path channel of a scan when BufferSize is unset
+const SCAN_BUFFER_PER_WORKER = 16
+
+// bufferSize is BufferSize, or SCAN_BUFFER_PER_WORKER per reader when unset
+func (s *FileScanner) bufferSize(workers int) int {
+	if s.BufferSize > 0 {
+		return s.BufferSize
+	}
+	return workers * SCAN_BUFFER_PER_WORKER
 }
 
 // FileScanner handles the directory traversal logic
 type FileScanner struct {
-	Root         string
-	IgnoredNames map[string]bool
-	Patterns     []string
-	AllowedExts  map[string]bool
+	Root           string
+	IgnoredNames   map[string]bool
+	Patterns       []IgnoreRule // Root .gitignore and .viberignore rules, in file order
+	Excludes       []IgnoreRule // -exclude rules, applied after every ignore file
+	Includes       []IgnoreRule // -include rules, overriding every ignore rule
+	AllowedExts    map[string]bool
+	IncludeGlobs   []string       // Base-name globs accepted on top of AllowedExts (-include-glob)
+	ExcludeDirs    []string       // Globs on root-relative directory paths to skip, "**" allowed (-exclude-dir-glob)
+	MaxFilesPerDir int            // 0 = unlimited
+	IncludeEmpty   bool           // Keep zero-byte files
+	BufferSize     int            // Paths queued for the readers of a scan (-scan-buffer), 0 = derived from worker count
+	Workers        int            // Concurrent file readers for BuildIndex and Scan (-workers), 0 = runtime.NumCPU()
+	ScanArchives   bool           // Look inside .zip/.tar.gz files for matching entries
+	AnnotateRoles  bool           // Tag FILE headers with a guessed role
+	SplitTokens    int            // Split files bigger than this (estimated tokens) into numbered parts, 0 = never
+	DedupeImports  bool           // Collapse TS/JS import sections into a one-line summary (lossy)
+	DimLargeFiles  int            // Files over this many estimated tokens keep only their head and declarations, 0 = off
+	Checkpoint     *Checkpoint    // Saves BuildIndex progress for -resume, nil = off
+	ContextOrder   string         // -context-order strategy, "" = ORDER_PINNED_FIRST
+	DedupeCase     bool           // Keep only the first of paths that differ only by case
+	ExcludeContent *regexp.Regexp // Skip files whose first few KB match, nil = off
+	IncludeContent *regexp.Regexp // Keep only files whose content matches, nil = off
+	Progress       *WalkProgress  // Shows the directory being walked, nil = quiet
+	AbortOnRead    bool           // -on-read-error abort: the first unreadable file fails the scan
+	MaxContext     int            // Budget in estimated tokens for the files of one context, 0 = unlimited
+	AbsolutePaths  bool           // Show absolute paths in FILE headers; paths are root-relative otherwise
+	CountIgnored   bool           // Walk skipped directories just to count their files for IgnoreHits (-dry-run)
+	GoDoc          bool           // Add `go doc` API blocks for the Go packages in a context
+	GoDocOnly      bool           // With GoDoc, send the API blocks instead of the documented packages' source
+	Stats          ScanStats
+	cache          *ContentCache
+	goDocs         *goDocCache
+	ignoreNames    []string     // Ignore file names also read in subdirectories
+	nested         []IgnoreRule // Rules of the subdirectory ignore files met by the last walk
+
+	// Extension (or PREPROCESS_ALL) -> command file contents are piped through (-preprocess)
+	Preprocessors map[string]string
+}
+
+// ScanStats records what the last walk left out
+type ScanStats struct {
+	CappedDirs           map[string]int // directory -> files skipped by MaxFilesPerDir
+	SkippedEmpty         int            // zero-byte files left out
+	SkippedTooLarge      []string       // files over MAX_SANE_FILE_SIZE
+	SymlinkLoops         []string       // links pointing back into walked directories
+	SymlinkRepeats       []string       // links to a file an earlier link already reached
+	SkippedBinary        int            // files with NUL bytes near the start
+	TokensSaved          int            // estimated tokens removed by content transforms
+	Resumed              int            // index entries reused from a checkpoint
+	CaseCollisions       [][2]string    // {first, later} paths that differ only by case
+	ExcludedByContent    int            // files whose start matched ExcludeContent
+	NotIncludedByContent int            // files that did not match IncludeContent
+	IgnoreHits           map[string]int // ignore rule label -> files it excluded (see CountIgnored for directories)
+}
+
+// EXCLUDE_CONTENT_SNIFF_SIZE is how much of a file -exclude-content looks at;
+// generated-code markers sit at the top
+const EXCLUDE_CONTENT_SNIFF_SIZE = 4096
+
+// contentSniffSize is how many leading bytes the content filters need
+func (s *FileScanner) contentSniffSize() int {
+	if s.ExcludeContent != nil {
+		return EXCLUDE_CONTENT_SNIFF_SIZE
+	}
+	return 0
+}
+
+// excludedByContent reports whether the start of content matches -exclude-content
+func (s *FileScanner) excludedByContent(content string) bool {
+	return s.ExcludeContent != nil && s.ExcludeContent.MatchString(content[:min(len(content), EXCLUDE_CONTENT_SNIFF_SIZE)])
+}
+
+// INCLUDE_CONTENT_MAX_SIZE bounds how much of a file -include-content searches
+const INCLUDE_CONTENT_MAX_SIZE = 1024 * 1024
+
+// includedByContent reports whether content matches -include-content (always
+// true when the filter is off)
+func (s *FileScanner) includedByContent(content string) bool {
+	return s.IncludeContent == nil || s.IncludeContent.MatchString(content[:min(len(content), INCLUDE_CONTENT_MAX_SIZE)])
+}
+
+// BINARY_SNIFF_SIZE is how much of a file is checked for NUL bytes
+const BINARY_SNIFF_SIZE = 8000
+
+// isBinary uses git's heuristic: text files don't contain NUL bytes
+func isBinary(content string) bool {
+	return strings.IndexByte(content[:min(len(content), BINARY_SNIFF_SIZE)], 0) >= 0
 }
 
 func NewScanner(root string, ignoreFile string, extensions []string) (*FileScanner, error) {
+	// Paths are kept relative to the root, so anchor it once
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
 	s := &FileScanner{
 		Root: root,
 		IgnoredNames: map[string]bool{
@@ -294,83 +1099,223 @@ func NewScanner(root string, ignoreFile string, extensions []string) (*FileScann
 			".next":        true,
 			"__pycache__":  true,
 			"vendor":       true,
+			RAG_DIR:        true,
 		},
 		AllowedExts: make(map[string]bool),
+		cache:       NewContentCache(),
+		goDocs:      newGoDocCache(),
 	}
 	for _, ext := range extensions {
 		s.AllowedExts[ext] = true
 	}
 
-	file, err := os.Open(ignoreFile)
-	if err == nil {
-		defer file.Close()
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line != "" && !strings.HasPrefix(line, "#") {
-				s.Patterns = append(s.Patterns, line)
-			}
-		}
+	// Ignore files belong to the tree being scanned, not the working directory
+	if !filepath.IsAbs(ignoreFile) {
+		ignoreFile = filepath.Join(root, ignoreFile)
 	}
+	for _, path := range []string{ignoreFile, filepath.Join(root, VIBER_IGNORE_FILE)} {
+		s.Patterns = append(s.Patterns, readIgnoreFile(path)...)
+	}
+	s.ignoreNames = []string{filepath.Base(ignoreFile), VIBER_IGNORE_FILE}
 	return s, nil
 }
 
+// absPath resolves a root-relative path (or "archive!entry" path) for disk access
+func (s *FileScanner) absPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(s.Root, path)
+}
+
+// relPath turns an absolute path under the root into the root-relative form
+// the scanner keeps; relative paths are taken as root-relative already, and
+// paths outside the root are returned unchanged
+func (s *FileScanner) relPath(path string) string {
+	if !filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	rel, err := filepath.Rel(s.Root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// DisplayPath is how a path appears in FILE headers and exports: relative
+// to the root, or absolute with AbsolutePaths
+func (s *FileScanner) DisplayPath(path string) string {
+	if s.AbsolutePaths {
+		return s.absPath(path)
+	}
+	return path
+}
+
+// VIBER_IGNORE_FILE holds extra patterns for viber only, in .gitignore syntax
+const VIBER_IGNORE_FILE = ".viberignore"
+
+// readIgnoreFile returns the patterns of an ignore file; a missing file has none
+func readIgnoreFile(path string) []IgnoreRule {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var rules []IgnoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
 func (s *FileScanner) ScanForAI(workerCount int, callback func(fc FileContent)) error {
-	pathsChan := make(chan string, 100)
+	pathsChan := make(chan string, s.bufferSize(workerCount))
 	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var readErrs []ReadError
+	var abortErr error // first read error with AbortOnRead; later paths are drained unread
+	matched := 0
 
 	for i := 0; i < workerCount; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for path := range pathsChan {
-				bytes, err := os.ReadFile(path)
+				mu.Lock()
+				aborted := abortErr != nil
+				mu.Unlock()
+				if aborted {
+					continue
+				}
+
+				content, err := s.ReadFile(path)
 				if err != nil {
+					mu.Lock()
+					if !s.AbortOnRead {
+						readErrs = append(readErrs, ReadError{Path: path, Err: err})
+					} else if abortErr == nil {
+						abortErr = ReadError{Path: path, Err: err}
+					}
+					mu.Unlock()
+					continue
+				}
+				if isBinary(content) {
+					mu.Lock()
+					s.Stats.SkippedBinary++
+					mu.Unlock()
+					continue
+				}
+				if s.excludedByContent(content) {
+					mu.Lock()
+					s.Stats.ExcludedByContent++
+					mu.Unlock()
+					continue
+				}
+				if !s.includedByContent(content) {
+					mu.Lock()
+					s.Stats.NotIncludedByContent++
+					mu.Unlock()
 					continue
 				}
-				callback(FileContent{Path: path, Content: string(bytes)})
+				content, saved := s.transform(path, content)
+				if saved > 0 {
+					mu.Lock()
+					s.Stats.TokensSaved += saved
+					mu.Unlock()
+				}
+				fc := FileContent{Path: path, Content: content}
+				if s.AnnotateRoles {
+					fc.Role = ClassifyFile(path, content)
+				}
+				callback(fc)
 			}
 		}()
 	}
 
-	err := filepath.WalkDir(s.Root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			if s.IgnoredNames[d.Name()] {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		if !s.AllowedExts[filepath.Ext(path)] {
-			return nil
-		}
-		for _, p := range s.Patterns {
-			if matched, _ := filepath.Match(p, d.Name()); matched {
-				return nil
-			}
+	err := s.walkFiles(func(path string) error {
+		mu.Lock()
+		aborted := abortErr
+		mu.Unlock()
+		if aborted != nil {
+			return aborted
 		}
+		matched++
 		pathsChan <- path
 		return nil
 	})
 
-	close(pathsChan)
-	wg.Wait()
-	return err
+	close(pathsChan)
+	wg.Wait()
+	if abortErr != nil {
+		return abortErr
+	}
+	return scanResult(err, matched, readErrs)
+}
+
+// transform applies the opt-in content rewrites (-dedupe-imports,
+// -dim-large-files) to a file about to be sent and returns the estimated
+// tokens they saved
+func (s *FileScanner) transform(path string, content string) (string, int) {
+	saved := 0
+	if s.DedupeImports {
+		var n int
+		content, n = CollapseImports(path, content)
+		saved += n
+	}
+	if tokens := EstimateTokens(content); s.DimLargeFiles > 0 && tokens > s.DimLargeFiles {
+		dimmed := DimContent(content, tokens)
+		saved += tokens - EstimateTokens(dimmed)
+		content = dimmed
+	}
+	return content, saved
+}
+
+// Scan runs ScanForAI and returns every file sorted by path, so results are
+// deterministic regardless of worker scheduling. Like ScanForAI it may
+// return a *MultiReadError alongside the files that were read.
+func (s *FileScanner) Scan(workerCount int) ([]FileContent, error) {
+	_, span := tracer.Start(context.Background(), "scan.read")
+	var mu sync.Mutex
+	var files []FileContent
+	err := s.ScanForAI(workerCount, func(fc FileContent) {
+		mu.Lock()
+		files = append(files, fc)
+		mu.Unlock()
+	})
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	span.SetAttributes(attribute.Int("viber.files", len(files)))
+	endSpan(span, err)
+	return files, err
 }
 
 // Spinner shows a small animation while the AI is thinking
 func (ai *AIClient) playSpinner(ctx context.Context, done chan bool) {
 	frames := []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
 	i := 0
+
+	width := terminalWidth()
+	if width <= 0 {
+		<-done // No spinner in pipes and logs
+		return
+	}
+
+	// A wrapped status line can't be redrawn with \r, so drop the label when narrow
+	label := " AI is thinking..."
+	if width <= len(label)+2 {
+		label = ""
+	}
 	for {
 		select {
 		case <-done:
-			fmt.Print("\r          \r") // Clear the spinner line
+			fmt.Print("\r\033[K") // Clear the spinner line
 			return
 		default:
-			fmt.Printf("\r\033[35m%s\033[0m AI is thinking...", frames[i])
+			fmt.Printf("\r\033[35m%s\033[0m%s", frames[i], label)
 			i = (i + 1) % len(frames)
 			time.Sleep(100 * time.Millisecond)
 		}
@@ -378,7 +1323,21 @@ func (ai *AIClient) playSpinner(ctx context.Context, done chan bool) {
 }
 
 func (s *Session) AskQuestion(ctx context.Context, question string) error {
-	// PHASE 1: Select
+	if s.noContext {
+		return s.ask(ctx, "", question)
+	}
+	if s.namesOnly {
+		// No selection round either: it would send the index summaries
+		s.lastPaths = s.indexPaths()
+		fmt.Printf("\033[33m🔒 Names only: sending the tree and declarations of %d files, no contents\033[0m\n", len(s.lastPaths))
+		return s.ask(ctx, s.scanner.StructureContext(s.lastPaths), question)
+	}
+	if s.rag != nil {
+		return s.askRetrieved(ctx, question)
+	}
+
+	// PHASE 1: Select (the index summaries already go to the model)
+	s.warnCloudCost()
 	fmt.Println("\033[90m🔍 Analyzing repository structure...\033[0m")
 	relevantPaths, err := s.selectRelevantFiles(ctx, question)
 	if err != nil {
@@ -395,29 +1354,237 @@ func (s *Session) AskQuestion(ctx context.Context, question string) error {
 		fmt.Println("\033[33m📄 No specific files identified, using general context.\033[0m")
 	}
 
+	if len(s.pinned) > 0 {
+		fmt.Printf("\033[33m📌 Plus %d pinned files (/add)\033[0m\n", len(s.pinned))
+	}
+	paths := s.contextPaths(relevantPaths)
+	s.lastPaths = paths
+
 	// PHASE 2: Load Content
+	repoContext, focused, saved, report := s.buildContext(ctx, paths)
+	s.lastBudget = report
+	if len(focused) > 0 {
+		fmt.Printf("\033[33m🎯 Focused: %s\033[0m\n", strings.Join(focused, ", "))
+	}
+	if saved > 0 {
+		fmt.Printf("\033[90m✂️  Compacting saved ~%d tokens\033[0m\n", saved)
+	}
+	printBudgetReport(report)
+	s.lastPaths = report.kept(s.lastPaths)
+	fmt.Printf("\033[90m📦 %d files loaded into context, %s\033[0m\n", len(s.lastPaths), formatContextTokens(EstimateTokens(repoContext), s.scanner.MaxContext))
+
+	// PHASE 3: Ask
+	fmt.Println("\033[90m🤖 Generating answer...\033[0m")
+	return s.ask(ctx, repoContext, question)
+}
+
+// warnCloudCost prints a one-time notice the first time a metered cloud
+// model is used in the session
+func (s *Session) warnCloudCost() {
+	model := s.ai.Model()
+	if s.config == nil || s.noCostWarning || s.costWarned[model] || !s.config.IsCloudModel(model) {
+		return
+	}
+	if s.costWarned == nil {
+		s.costWarned = make(map[string]bool)
+	}
+	s.costWarned[model] = true
+	fmt.Printf("\033[33m💸 %s runs in the cloud: requests may be metered and the repository context is sent off this machine (-no-cost-warning hides this)\033[0m\n", model)
+}
+
+// selectContext picks the files for a question and assembles their content
+// without printing anything, for callers that aren't the interactive loop.
+// It leaves the session unchanged so concurrent server requests can share
+// it; the files returned are the ones -max-context kept.
+func (s *Session) selectContext(ctx context.Context, question string) ([]string, string, error) {
+	if s.noContext {
+		return nil, "", nil
+	}
+	if s.namesOnly {
+		paths := s.indexPaths()
+		return paths, s.scanner.StructureContext(paths), nil
+	}
+	if s.rag != nil {
+		paths, repoContext, _, _, err := s.retrieveContext(ctx, question)
+		return paths, repoContext, err
+	}
+
+	relevantPaths, err := s.selectRelevantFiles(ctx, question)
+	if err != nil {
+		return nil, "", err
+	}
+	paths := s.contextPaths(relevantPaths)
+	repoContext, _, _, report := s.buildContext(ctx, paths)
+	return report.kept(paths), repoContext, nil
+}
+
+// ask sends the question with the given context and records the turn
+func (s *Session) ask(ctx context.Context, repoContext string, question string) error {
+	s.warnCloudCost()
+	completion, err := s.ai.AskAboutRepo(ctx, repoContext, s.withAttachments(question))
+	if err != nil {
+		return err
+	}
+	answer := completion.Answer
+	if s.tee {
+		// Raw copy after the rendered one, ready to copy or pipe
+		fmt.Println("\033[90m── raw markdown ──\033[0m")
+		fmt.Println(strings.TrimSpace(answer))
+	}
+	if s.pricing != nil {
+		cost := s.pricing.Cost(completion.PromptTokens, completion.CompletionTokens)
+		s.totalCost += cost
+		fmt.Printf("\033[90m💰 ~%s (%d in / %d out tokens), session total ~%s\033[0m\n",
+			formatCost(cost), completion.PromptTokens, completion.CompletionTokens, formatCost(s.totalCost))
+	}
+
+	s.turns = append(s.turns, Turn{Question: question, Answer: answer, Time: time.Now(), Tags: s.pendingTags})
+	s.pendingTags = nil
+	s.persist()
+	return nil
+}
+
+// buildContext reads the given files and joins them into FILE blocks. It
+// also returns the files that were moved up by /focus, the estimated tokens
+// saved by content transforms and what -max-context kept.
+func (s *Session) buildContext(ctx context.Context, paths []string) (string, []string, int, BudgetReport) {
+	_, span := tracer.Start(ctx, "context.assemble")
+	defer span.End()
+	displayPaths := make(map[string]string)
 	var builder strings.Builder
-	for _, path := range relevantPaths {
-		content, err := os.ReadFile(path)
+
+	if s.gitBlocks != "" {
+		builder.WriteString(s.gitBlocks)
+	}
+
+	saved := 0
+	var files []FileContent
+	for _, path := range paths {
+		content, err := s.scanner.ReadFile(path)
 		if err != nil {
 			continue
 		}
-		builder.WriteString(fmt.Sprintf("\n--- FILE: %s ---\n%s\n", path, content))
+		files = append(files, FileContent{Path: path, Content: content})
+	}
+	pinned := func(path string) bool {
+		return slices.Contains(s.pinned, path)
+	}
+	goDocs := ""
+	if s.scanner.GoDoc {
+		var covered map[string]bool
+		goDocs, covered = s.scanner.goDocBlocks(paths)
+		builder.WriteString(goDocs)
+		if s.scanner.GoDocOnly {
+			files = slices.DeleteFunc(files, func(fc FileContent) bool {
+				return covered[filepath.Dir(fc.Path)] && !strings.HasSuffix(fc.Path, "_test.go") && filepath.Ext(fc.Path) == ".go"
+			})
+		}
+	}
+	files = OrderFiles(s.scanner.ContextOrder, s.scanner.Root, files, pinned)
+	for i, fc := range files {
+		var n int
+		files[i].Content, n = s.scanner.transform(fc.Path, fc.Content)
+		saved += n
+	}
+	budget := s.scanner.MaxContext
+	if budget > 0 {
+		budget = max(budget-EstimateTokens(s.gitBlocks+goDocs), 0)
+	}
+	files, report := FitBudget(SplitFiles(files, s.scanner.SplitTokens), budget, func(path string) bool {
+		return pinned(path) || s.focused(path)
+	})
+	paths = paths[:0:0]
+	contents := make(map[string][]FileContent, len(files)) // kept parts of each file
+	for _, fc := range files {
+		if _, ok := contents[fc.Path]; !ok {
+			paths = append(paths, fc.Path)
+		}
+		contents[fc.Path] = append(contents[fc.Path], fc)
 	}
 
-	// PHASE 3: Ask
-	fmt.Println("\033[90m🤖 Generating answer...\033[0m")
-	return s.ai.AskAboutRepo(ctx, builder.String(), question)
+	paths, focused := s.applyFocus(paths)
+	if len(focused) > 0 {
+		builder.WriteString("Pay special attention to: " + strings.Join(focused, ", ") + "\n")
+	}
+
+	if s.prettyPaths {
+		var legend map[string]string
+		displayPaths, legend = AbbreviatePaths(paths)
+		if len(legend) > 0 {
+			builder.WriteString(formatPathLegend(legend))
+		}
+	}
+
+	for _, path := range paths {
+		parts := contents[path]
+		header := s.scanner.DisplayPath(path)
+		if short, ok := displayPaths[path]; ok {
+			header = short
+		}
+		if s.scanner.AnnotateRoles {
+			header = blockHeader(header, ClassifyFile(path, parts[0].Content))
+		}
+		for _, part := range parts {
+			builder.WriteString(formatFileBlock(part.label(header), part.Content))
+		}
+	}
+	span.SetAttributes(
+		attribute.Int("viber.files", len(paths)),
+		attribute.Int("viber.context_bytes", builder.Len()),
+	)
+	return builder.String(), focused, saved, report
+}
+
+// formatFileBlock renders one file the way the model sees it in the context
+func formatFileBlock(header string, content string) string {
+	return fmt.Sprintf("\n--- FILE: %s ---\n%s\n", header, content)
 }
 
 // Store index for later filtering
 type Session struct {
-	scanner *FileScanner
-	index   []FileIndex
-	ai      *AIClient
+	scanner     *FileScanner
+	index       []FileIndex
+	ai          *AIClient
+	prettyPaths bool     // Abbreviate long paths in FILE headers
+	lastPaths   []string // Files sent with the last question
+	turns       []Turn   // Question/answer history of the session
+	pendingTags []string // /tag categories for the next answer
+	savePath    string   // Markdown transcript written after every answer
+	tee         bool     // Also echo each raw Markdown answer to stdout
+	sessionName string   // -session: turns are loaded from and saved to this named session
+	noContext   bool     // Plain LLM mode: no scan, questions go out alone
+	namesOnly   bool     // Send the file tree and declarations only, never file contents
+	noRun       bool     // -no-run: /run is refused
+	attached    []string // /run output blocks waiting for the next question
+
+	// Context edits made with /add, /drop and /rescan, undoable with /undo
+	pinned  []string        // Files sent with every question
+	dropped map[string]bool // Files removed from the index
+	undo    []contextSnapshot
+	scanned map[string]fileStamp // Indexed files as of the last scan, for /reload
+
+	focus []string // /focus patterns; matching files go first and are called out
+
+	lastBudget BudgetReport // What -max-context kept for the last context
+
+	// -rag: questions get the closest embedded chunks instead of a selection round
+	rag      *RetrievalIndex
+	embedder *Embedder
+	ragTopK  int
+
+	gitBlocks string // Recent commits (-include-git-log, -since) and diff (-review, -diff, -staged) blocks, placed before the files
+
+	pricing   *Pricing // -price, nil = no cost estimates
+	totalCost float64  // Estimated cost of every answer so far
+
+	config        *Config
+	noCostWarning bool
+	costWarned    map[string]bool // Cloud models already announced this session
 }
 
-func (s *Session) selectRelevantFiles(ctx context.Context, question string) ([]string, error) {
+// selectionMessages is the file selection request for question: the index
+// paths with the start of their summaries
+func (s *Session) selectionMessages(question string) []api.Message {
 	// 1. Prepare Index Context (Path + Summary)
 	var indexContext strings.Builder
 	for _, idx := range s.index {
@@ -441,21 +1608,30 @@ func (s *Session) selectRelevantFiles(ctx context.Context, question string) ([]s
 
     RESPONSE (JSON Array):`, indexContext.String(), question)
 
-	// 3. Call LLM directly (bypass markdown renderer for parsing)
-	req := &api.ChatRequest{
-		Model: DEFAULT_MODEL,
-		Messages: []api.Message{
-			{Role: "system", Content: "You are a file selection engine. Return ONLY a JSON array of strings."},
-			{Role: "user", Content: prompt},
-		},
-		Stream: new(bool), // False
+	return []api.Message{
+		{Role: "system", Content: "You are a file selection engine. Return ONLY a JSON array of strings."},
+		{Role: "user", Content: prompt},
 	}
+}
 
-	var responseContent strings.Builder
-	err := s.ai.client.Chat(ctx, req, func(res api.ChatResponse) error {
-		responseContent.WriteString(res.Message.Content)
-		return nil
+func (s *Session) selectRelevantFiles(ctx context.Context, question string) ([]string, error) {
+	messages := s.selectionMessages(question)
+	model := s.ai.Model()
+
+	// 3. Call LLM directly (bypass markdown renderer for parsing)
+	ctx, span := tracer.Start(ctx, "context.select", trace.WithAttributes(
+		attribute.String("viber.model", model),
+		attribute.Int("viber.index_files", len(s.index)),
+		attribute.Int("viber.context_bytes", len(messages[1].Content)),
+	))
+	selection, err := s.ai.withLatestFallback(span, func() (Completion, error) {
+		return s.ai.provider.Chat(ctx, s.ai.Model(), messages, false, nil)
 	})
+	span.SetAttributes(
+		attribute.Int("viber.prompt_tokens", selection.PromptTokens),
+		attribute.Int("viber.completion_tokens", selection.CompletionTokens),
+	)
+	endSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -463,7 +1639,7 @@ func (s *Session) selectRelevantFiles(ctx context.Context, question string) ([]s
 	// 4. Parse JSON result
 	var paths []string
 	// Clean up markdown code blocks if the model adds them despite instructions
-	cleanJson := strings.ReplaceAll(responseContent.String(), "```json", "")
+	cleanJson := strings.ReplaceAll(selection.Answer, "```json", "")
 	cleanJson = strings.ReplaceAll(cleanJson, "```", "")
 
 	err = json.Unmarshal([]byte(cleanJson), &paths)
@@ -489,11 +1665,463 @@ func (s *Session) selectRelevantFiles(ctx context.Context, question string) ([]s
 	return validPaths, nil
 }
 
+// printScanStats reports the files the last walk under root left out
+func printScanStats(stats ScanStats, root string, maxPerDir int) {
+	if stats.Resumed > 0 {
+		fmt.Printf("\033[90m   Resumed %d files from the last checkpoint\033[0m\n", stats.Resumed)
+	}
+	if stats.TokensSaved > 0 {
+		fmt.Printf("\033[90m   Compacting saved ~%d tokens\033[0m\n", stats.TokensSaved)
+	}
+	if stats.SkippedBinary > 0 {
+		fmt.Printf("\033[90m   Skipped %d binary files\033[0m\n", stats.SkippedBinary)
+	}
+	if stats.ExcludedByContent > 0 {
+		fmt.Printf("\033[90m   Excluded %d files by content (-exclude-content)\033[0m\n", stats.ExcludedByContent)
+	}
+	if stats.NotIncludedByContent > 0 {
+		fmt.Printf("\033[90m   Left out %d files not matching -include-content\033[0m\n", stats.NotIncludedByContent)
+	}
+	if stats.SkippedEmpty > 0 {
+		fmt.Printf("\033[90m   Skipped %d empty files (use -include-empty to keep them)\033[0m\n", stats.SkippedEmpty)
+	}
+	for _, link := range stats.SymlinkLoops {
+		target, _ := filepath.EvalSymlinks(filepath.Join(root, link))
+		fmt.Printf("\033[33m⚠️  Symlink loop: %s -> %s (skipped)\033[0m\n", link, target)
+	}
+	for _, link := range stats.SymlinkRepeats {
+		target, _ := filepath.EvalSymlinks(filepath.Join(root, link))
+		fmt.Printf("\033[33m⚠️  Symlink repeat: %s -> %s (already indexed, skipped)\033[0m\n", link, target)
+	}
+	for _, path := range stats.SkippedTooLarge {
+		fmt.Printf("\033[33m⚠️  %s skipped (too large, over %d MB)\033[0m\n", path, MAX_SANE_FILE_SIZE/(1024*1024))
+	}
+	for _, pair := range stats.CaseCollisions {
+		fmt.Printf("\033[33m⚠️  %s and %s differ only by case (they collide on case-insensitive filesystems)\033[0m\n", pair[0], pair[1])
+	}
+	if len(stats.CappedDirs) > 0 {
+		dirs := make([]string, 0, len(stats.CappedDirs))
+		for dir := range stats.CappedDirs {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+
+		fmt.Printf("\033[33m⚠️  %d directories capped at %d files:\033[0m\n", len(dirs), maxPerDir)
+		for _, dir := range dirs {
+			fmt.Printf("   \033[90m- %s (%d skipped)\033[0m\n", dir, stats.CappedDirs[dir])
+		}
+	}
+}
+
 func main() {
 	dirPtr := flag.String("dir", ".", "The directory to analyze")
+	servePtr := flag.String("serve", "", "Run as an HTTP server on this address (e.g. :8080) instead of the interactive loop")
+	modelInfoPtr := flag.Bool("model-info", false, "Show the selected model's context length, size, quantization and template, then exit")
+	exportPtr := flag.String("export", "", "Write the scanned files as a shareable context bundle with a header, then exit")
+	breakdownPtr := flag.Bool("context-breakdown", false, "After scanning, print how the indexed bytes and tokens split by directory")
+	breakdownDepthPtr := flag.Int("breakdown-depth", 1, "Directory levels -context-breakdown groups by (1 = top-level directories)")
+	dryRunPtr := flag.Bool("dry-run", false, "Scan and report what would be indexed, including how many files each ignore rule excluded, then exit")
+	namesOnlyPtr := flag.Bool("names-only", false, "Privacy mode: send only file names and declaration lines, never file contents")
+	noContextPtr := flag.Bool("no-context", false, "Skip scanning and ask questions without any repository context")
+	savePtr := flag.String("save", "", "Write the session transcript (raw Markdown) to this file")
+	sessionPtr := flag.String("session", "", "Resume (or start) a named session; its turns are saved after every answer")
+	sessionsPtr := flag.Bool("sessions", false, "List saved sessions and exit")
+	teePtr := flag.Bool("tee", false, "Echo each answer's raw Markdown to stdout after the rendered version")
+	prettyPathsPtr := flag.Bool("pretty-paths", false, "Abbreviate long directory paths in context headers (adds a legend)")
+	gitLogPtr := flag.Int("include-git-log", 0, "Attach the last N commits (git log --oneline --stat) to the context")
+	diffPtr := flag.Bool("diff", false, "Attach the unstaged changes (git diff) to every question")
+	stagedPtr := flag.Bool("staged", false, "Attach the staged changes (git diff --staged) to every question, e.g. to review them before committing")
+	sincePtr := flag.String("since", "", "Attach the commits after a revision (HEAD~5, main) or since a date (\"2 days ago\"), with their patches")
+	annotateRolesPtr := flag.Bool("annotate-roles", false, "Label each file in the context with a guessed role (e.g. \"Svelte component\", \"Go test\")")
+	splitTokensPtr := flag.Int("split-tokens", 0, "Split files larger than ~N tokens into numbered part blocks at line boundaries (0 = off)")
+	goDocPtr := flag.Bool("go-doc", false, "Add the exported API of each Go package in the context (go doc -all) as extra blocks")
+	goDocOnlyPtr := flag.Bool("go-doc-only", false, "Like -go-doc, but send the API blocks instead of the packages' non-test source")
+	preprocessPtr := flag.String("preprocess", "", "Pipe file contents through a command before use: one command for all files, or per extension (e.g. \".go=gofmt,.enc=sops -d /dev/stdin\")")
+	dedupeImportsPtr := flag.Bool("dedupe-imports", false, "Collapse TS/JS import sections into a one-line summary to save tokens (lossy)")
+	scanArchivesPtr := flag.Bool("scan-archives", false, "Include matching text files from inside .zip and .tar.gz archives")
+	includeEmptyPtr := flag.Bool("include-empty", false, "Include zero-byte files in the context")
+	noRunPtr := flag.Bool("no-run", false, "Disable the /run command (it executes shell commands with your permissions)")
+	absolutePathsPtr := flag.Bool("absolute-paths", false, "Show absolute paths in FILE headers instead of paths relative to -dir")
+	maxContextPtr := flag.String("max-context", "", "Context budget per question: estimated tokens (8000, 32k) or bytes (256KB); smaller source files win, the rest is dropped")
+	maxPerDirPtr := flag.Int("max-files-per-dir", 0, "Maximum number of files taken from a single directory (0 = unlimited)")
+	renderCmdPtr := flag.String("render-cmd", "", "Pipe answers through this command instead of glamour (e.g. \"bat -l md\")")
+	emptyHintPtr := flag.Int("max-empty-question-retries", 2, "Print a hint about /help after this many empty inputs in a row (0 = never)")
+	pricePtr := flag.String("price", "", "Per-million-token prices for cost estimates, e.g. \"in=0.5,out=1.5\"")
+	questionPtr := flag.String("q", "", "Ask this one question non-interactively, then exit (\"-\" reads it from stdin)")
+	flag.StringVar(questionPtr, "ask", "", "Same as -q")
+	formatPtr := flag.String("format", "", "With -q, print only the answer to stdout as plain, markdown or json, status lines going to stderr (default markdown when stdout is not a terminal)")
+	questionFilePtr := flag.String("q-file", "", "Like -q, with the question read from a file (# comment lines dropped)")
+	questionsFilePtr := flag.String("questions-file", "", "Ask each line of this file in order (blank lines and # comments skipped), then exit")
+	confirmEachPtr := flag.Bool("confirm-each", false, "With -questions-file, show each question's estimated prompt size and ask before sending anything")
+	onReadErrorPtr := flag.String("on-read-error", ON_READ_ERROR_CONTINUE, "What an unreadable file does to the scan: continue (report it at the end) or abort")
+	dimLargePtr := flag.Int("dim-large-files", 0, "Send files over ~N tokens as their first lines and declarations only, marked low priority (0 = off)")
+	excludeDirGlobPtr := flag.String("exclude-dir-glob", "", "Comma-separated globs on directory paths relative to -dir to skip (e.g. \"**/generated,packages/*/dist\")")
+	excludePtr := flag.String("exclude", "", "Comma-separated .gitignore-style patterns to skip on top of the ignore files (e.g. \"fixtures/,*.snap\")")
+	includePtr := flag.String("include", "", "Comma-separated .gitignore-style patterns to scan even when ignored; patterns with a / reach into ignored directories (e.g. \"dist/app.js\")")
+	includeGlobPtr := flag.String("include-glob", "", "Comma-separated base-name globs to scan besides the extension list (e.g. \"*.stories.tsx,*.config.js\")")
+	includeContentPtr := flag.String("include-content", "", "Keep only files whose content matches this regex (e.g. \"PaymentService\"); searches the first 1 MB")
+	excludeContentPtr := flag.String("exclude-content", "", "Skip files whose first 4 KB match this regex (e.g. \"Code generated .* DO NOT EDIT\")")
+	dedupeCasePtr := flag.Bool("dedupe-case", false, "When two paths differ only by case, keep just the first one")
+	contextOrderPtr := flag.String("context-order", ORDER_PINNED_FIRST, "How files are ordered in the context: "+strings.Join(ContextOrderNames(), ", "))
+	reviewPtr := flag.Bool("review", false, "Answer with file:line review comments (severity error, warning or suggestion), reviewing the uncommitted git diff when there is one")
+	reviewJSONPtr := flag.Bool("review-json", false, "Like -review, but print the comments as a JSON array of {file, line, severity, comment}")
+	validatePtr := flag.String("validate", "", "Regular expression every answer must match; failing answers are sent back to the model")
+	retriesPtr := flag.Int("retries", 2, "How many times to re-ask when an answer fails -validate")
+	resumePtr := flag.Bool("resume", false, "Continue an interrupted scan from its checkpoint instead of starting over")
+	embedPtr := flag.String("embed", "", "In -serve mode, also return embeddings of the answer (in chunks), the question or both: answer, question or both (one extra request each)")
+	embedModelPtr := flag.String("embed-model", DEFAULT_EMBED_MODEL, "Embedding model used by -embed and -rag")
+	ragPtr := flag.Bool("rag", false, "Send the chunks closest to each question by embedding similarity instead of asking the model to pick files (cached in .viber/ under -dir)")
+	ragTopKPtr := flag.Int("rag-top-k", RAG_TOP_K, "How many chunks -rag sends per question")
+	reindexPtr := flag.Bool("reindex", false, "Rebuild the -rag embeddings cache from scratch (implies -rag)")
+	wrapPtr := flag.Int("wrap", MAX_WRAP_WIDTH, "Widest line of rendered answers, in columns (narrower terminals wrap sooner)")
+	scanBufferPtr := flag.Int("scan-buffer", 0, "Paths queued for the file readers while scanning (default 16 per -workers)")
+	workersPtr := flag.Int("workers", runtime.NumCPU(), "How many files are read at once while scanning")
+	renderWorkersPtr := flag.Int("render-workers", runtime.NumCPU(), "How many answers may be rendered at once (e.g. /history reprints), to bound memory on large runs")
+	prettyJSONPtr := flag.Bool("pretty-json", false, "Indent JSON responses in -serve mode (default is compact, one object per line)")
+	noCostWarningPtr := flag.Bool("no-cost-warning", false, "Don't print the notice about metered cloud models")
+	modelPtr := flag.String("model", "", "Model to use, skipping the picker (default: the saved default model)")
+	systemPromptPtr := flag.String("system-prompt", "", "Replace the built-in system prompt; \"@path\" reads it from a file")
+	extensionsPtr := flag.String("extensions", strings.Join(defaultExtensions, ","), "Comma-separated extensions (or exact file names, like justfile) to scan")
+	endpointPtr := flag.String("endpoint", ENDPOINT_CHAT, "Ollama endpoint to use: chat or generate")
+	providerPtr := flag.String("provider", "", "LLM backend: ollama, openai (any OpenAI-compatible API, e.g. LiteLLM or vLLM) or anthropic (default $VIBER_PROVIDER, else ollama)")
+	baseURLPtr := flag.String("base-url", "", "Base URL of the provider, e.g. http://localhost:4000/v1 (default $VIBER_BASE_URL, then OLLAMA_HOST, OPENAI_BASE_URL or ANTHROPIC_BASE_URL)")
+	apiKeyPtr := flag.String("api-key", "", "API key for the provider (default $VIBER_API_KEY, then OPENAI_API_KEY or ANTHROPIC_API_KEY)")
+	historyTurnsPtr := flag.Int("history-turns", MAX_HISTORY_TURNS, "How many earlier questions and answers are resent with each interactive question (0 = none)")
+	summarizeHistoryPtr := flag.Bool("summarize-history", false, "Summarize exchanges past -history-turns instead of dropping them (one extra request each time)")
+	repeatSystemPtr := flag.Bool("repeat-system-prompt", false, "Repeat a short form of the system instructions right before each question (~30 extra tokens per request)")
+	streamPtr := flag.Bool("stream", true, "Print answers as they arrive (-stream=false waits and renders once, e.g. when piping to a file)")
+	otelEndpointPtr := flag.String("otel-endpoint", "", "Export OpenTelemetry spans over OTLP/HTTP to this collector (host:port or URL)")
 	flag.Parse()
 
-	allowedExtensions := []string{".svelte", ".ts", ".go", ".html", ".sql", ".yml", "justfile", ".rs"}
+	// Scripted one-shot: only the answer goes to stdout. Started before the
+	// config files so their messages stay out of the answer; a config that
+	// sets format starts it after.
+	var oneShot *OneShot
+	exit := func(code int) {
+		if oneShot != nil {
+			oneShot.Close() // os.Exit skips the deferred flush
+		}
+		os.Exit(code)
+	}
+	startOneShot := func() {
+		question := *questionPtr != "" || *questionFilePtr != ""
+		if oneShot != nil || *questionsFilePtr != "" || (*formatPtr == "" && !question) {
+			return
+		}
+		var err error
+		if oneShot, err = StartOneShot(*formatPtr); err != nil {
+			fmt.Printf("\033[31m❌ Cannot redirect status output: %v\033[0m\n", err)
+			exit(1)
+		}
+	}
+	startOneShot()
+
+	// Per-project defaults from the nearest .viber.yaml (command-line flags win)
+	if projectConfig, ok := FindProjectConfig("."); ok {
+		if err := ApplyProjectConfig(projectConfig); err != nil {
+			fmt.Printf("\033[33m⚠️  Error loading %s: %v\033[0m\n", projectConfig, err)
+		} else {
+			fmt.Printf("\033[36m📁 Using project config: %s\033[0m\n", projectConfig)
+		}
+	}
+	// Personal defaults from ~/.config/viber/config.yaml (the project config wins)
+	if userConfig, ok := UserConfigPath(); ok {
+		if err := ApplyProjectConfig(userConfig); err != nil {
+			fmt.Printf("\033[33m⚠️  Error loading %s: %v\033[0m\n", userConfig, err)
+		} else {
+			fmt.Printf("\033[36m📁 Using user config: %s\033[0m\n", userConfig)
+		}
+	}
+	startOneShot()
+	if oneShot != nil {
+		defer oneShot.Close()
+	}
+
+	if *sessionsPtr {
+		if err := printSessions(); err != nil {
+			fmt.Printf("\033[31m❌ Cannot list sessions: %v\033[0m\n", err)
+			exit(1)
+		}
+		return
+	}
+
+	var resumed *SavedSession
+	if *sessionPtr != "" {
+		var err error
+		if resumed, err = LoadSession(*sessionPtr); err != nil {
+			fmt.Printf("\033[31m❌ Cannot load session: %v\033[0m\n", err)
+			exit(1)
+		}
+	}
+
+	if *endpointPtr != ENDPOINT_CHAT && *endpointPtr != ENDPOINT_GENERATE {
+		fmt.Printf("\033[31m❌ Invalid -endpoint '%s' (use chat or generate)\033[0m\n", *endpointPtr)
+		exit(2)
+	}
+
+	provider, err := NewProvider(ProviderOptions{Name: *providerPtr, BaseURL: *baseURLPtr, APIKey: *apiKeyPtr})
+	if err != nil {
+		fmt.Printf("\033[31m❌ Invalid -provider: %v\033[0m\n", err)
+		exit(2)
+	}
+	if _, ok := provider.(*OllamaProvider); !ok && *endpointPtr == ENDPOINT_GENERATE {
+		fmt.Println("\033[33m⚠️  -endpoint generate only applies to Ollama, using chat\033[0m")
+	}
+
+	if *onReadErrorPtr != ON_READ_ERROR_CONTINUE && *onReadErrorPtr != ON_READ_ERROR_ABORT {
+		fmt.Printf("\033[31m❌ Invalid -on-read-error '%s' (use continue or abort)\033[0m\n", *onReadErrorPtr)
+		exit(2)
+	}
+
+	switch *embedPtr {
+	case "", EMBED_ANSWER, EMBED_QUESTION, EMBED_BOTH:
+	default:
+		fmt.Printf("\033[31m❌ Invalid -embed '%s' (use answer, question or both)\033[0m\n", *embedPtr)
+		exit(2)
+	}
+	if *embedPtr != "" && *servePtr == "" {
+		fmt.Println("\033[33m⚠️  -embed only applies to -serve responses, ignoring it\033[0m")
+	}
+
+	if *reindexPtr {
+		*ragPtr = true
+	}
+	if *ragPtr && *ragTopKPtr < 1 {
+		fmt.Printf("\033[31m❌ Invalid -rag-top-k %d (use 1 or more)\033[0m\n", *ragTopKPtr)
+		exit(2)
+	}
+
+	if _, ok := contextOrders[*contextOrderPtr]; !ok {
+		fmt.Printf("\033[31m❌ Invalid -context-order '%s' (use %s)\033[0m\n", *contextOrderPtr, strings.Join(ContextOrderNames(), ", "))
+		exit(2)
+	}
+
+	var pricing *Pricing
+	if *pricePtr != "" {
+		var err error
+		if pricing, err = ParsePricing(*pricePtr); err != nil {
+			fmt.Printf("\033[31m❌ Invalid -price: %v\033[0m\n", err)
+			exit(2)
+		}
+	}
+
+	var questions []string
+	if *questionsFilePtr != "" {
+		var err error
+		questions, err = ReadQuestions(*questionsFilePtr)
+		if err != nil {
+			fmt.Printf("\033[31m❌ Cannot read -questions-file: %v\033[0m\n", err)
+			exit(2)
+		}
+		if len(questions) == 0 {
+			fmt.Printf("\033[31m❌ No questions in %s\033[0m\n", *questionsFilePtr)
+			exit(2)
+		}
+	}
+	switch *formatPtr {
+	case "", FORMAT_PLAIN, FORMAT_MARKDOWN, FORMAT_JSON:
+	default:
+		fmt.Printf("\033[31m❌ Invalid -format %q (use %s, %s or %s)\033[0m\n", *formatPtr, FORMAT_PLAIN, FORMAT_MARKDOWN, FORMAT_JSON)
+		exit(2)
+	}
+	if oneShot != nil && (*questionsFilePtr != "" || *servePtr != "") {
+		fmt.Println("\033[31m❌ -format works with a single question (-q, -q-file or piped stdin), not -questions-file or -serve\033[0m")
+		exit(2)
+	}
+	if oneShot != nil && *questionPtr == "" && *questionFilePtr == "" {
+		*questionPtr = "-" // -format alone: the question is piped in
+	}
+	if *questionPtr != "" || *questionFilePtr != "" {
+		if *questionsFilePtr != "" || (*questionPtr != "" && *questionFilePtr != "") {
+			fmt.Println("\033[31m❌ Use only one of -q, -q-file and -questions-file\033[0m")
+			exit(2)
+		}
+		question := strings.TrimSpace(*questionPtr)
+		if *questionFilePtr != "" {
+			var err error
+			if question, err = ReadQuestionFile(*questionFilePtr); err != nil {
+				fmt.Printf("\033[31m❌ Cannot read -q-file: %v\033[0m\n", err)
+				exit(2)
+			}
+		} else if question == "-" {
+			var err error
+			if question, err = ReadStdinQuestion(); err != nil {
+				fmt.Printf("\033[31m❌ Cannot read the question from stdin: %v\033[0m\n", err)
+				exit(2)
+			}
+		}
+		if question == "" {
+			fmt.Println("\033[31m❌ The question is empty\033[0m")
+			exit(2)
+		}
+		questions = []string{question}
+	}
+
+	systemPrompt := *systemPromptPtr
+	if path, ok := strings.CutPrefix(systemPrompt, "@"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("\033[31m❌ Cannot read -system-prompt: %v\033[0m\n", err)
+			exit(2)
+		}
+		systemPrompt = strings.TrimSpace(string(data))
+	}
+
+	var validator *AnswerValidator
+	if *validatePtr != "" {
+		pattern, err := regexp.Compile(*validatePtr)
+		if err != nil {
+			fmt.Printf("\033[31m❌ Invalid -validate pattern: %v\033[0m\n", err)
+			exit(2)
+		}
+		validator = &AnswerValidator{Pattern: pattern, Retries: max(*retriesPtr, 0)}
+	}
+	review := ""
+	switch {
+	case *reviewJSONPtr:
+		review = REVIEW_JSON
+	case *reviewPtr:
+		review = REVIEW_TEXT
+	}
+	if review != "" && validator == nil {
+		validator = reviewValidator(max(*retriesPtr, 0))
+	}
+
+	if *otelEndpointPtr != "" {
+		shutdown, err := SetupTracing(context.Background(), *otelEndpointPtr)
+		if err != nil {
+			fmt.Printf("\033[31m❌ Cannot set up tracing: %v\033[0m\n", err)
+			exit(2)
+		}
+		defer func() {
+			if err := shutdown(context.Background()); err != nil {
+				fmt.Printf("\033[33m⚠️  Could not flush traces: %v\033[0m\n", err)
+			}
+		}()
+	}
+
+	var allowedExtensions []string
+	for _, ext := range strings.Split(*extensionsPtr, ",") {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			allowedExtensions = append(allowedExtensions, ext)
+		}
+	}
+	if len(allowedExtensions) == 0 {
+		fmt.Println("\033[31m❌ -extensions is empty\033[0m")
+		exit(2)
+	}
+
+	scanner, err := NewScanner(*dirPtr, ".gitignore", allowedExtensions)
+	if err != nil {
+		fmt.Printf("Scanner Error: %v\n", err)
+		return
+	}
+	scanner.MaxFilesPerDir = *maxPerDirPtr
+	scanner.IncludeEmpty = *includeEmptyPtr
+	scanner.Workers = *workersPtr
+	scanner.BufferSize = *scanBufferPtr
+	scanner.ScanArchives = *scanArchivesPtr
+	scanner.AnnotateRoles = *annotateRolesPtr
+	scanner.SplitTokens = *splitTokensPtr
+	scanner.DedupeImports = *dedupeImportsPtr
+	if scanner.Preprocessors, err = ParsePreprocessors(*preprocessPtr); err != nil {
+		fmt.Printf("\033[31m❌ Invalid -preprocess: %v\033[0m\n", err)
+		exit(2)
+	}
+	scanner.GoDoc = *goDocPtr || *goDocOnlyPtr
+	scanner.GoDocOnly = *goDocOnlyPtr
+	scanner.ContextOrder = *contextOrderPtr
+	scanner.DedupeCase = *dedupeCasePtr
+	scanner.DimLargeFiles = *dimLargePtr
+	scanner.AbortOnRead = *onReadErrorPtr == ON_READ_ERROR_ABORT
+	scanner.AbsolutePaths = *absolutePathsPtr
+	if *maxContextPtr != "" {
+		if scanner.MaxContext, err = ParseContextSize(*maxContextPtr); err != nil {
+			fmt.Printf("\033[31m❌ Invalid -max-context: %v\033[0m\n", err)
+			exit(2)
+		}
+	}
+	for _, glob := range strings.Split(*includeGlobPtr, ",") {
+		if glob = strings.TrimSpace(glob); glob == "" {
+			continue
+		}
+		if _, err := filepath.Match(glob, ""); err != nil {
+			fmt.Printf("\033[31m❌ Invalid -include-glob '%s': %v\033[0m\n", glob, err)
+			exit(2)
+		}
+		scanner.IncludeGlobs = append(scanner.IncludeGlobs, glob)
+	}
+	for _, glob := range strings.Split(*excludeDirGlobPtr, ",") {
+		if glob = strings.Trim(strings.TrimSpace(glob), "/"); glob == "" {
+			continue
+		}
+		if _, err := filepath.Match(glob, ""); err != nil {
+			fmt.Printf("\033[31m❌ Invalid -exclude-dir-glob '%s': %v\033[0m\n", glob, err)
+			exit(2)
+		}
+		scanner.ExcludeDirs = append(scanner.ExcludeDirs, glob)
+	}
+	if scanner.Excludes, err = ParseIgnoreOverrides(*excludePtr, "-exclude"); err != nil {
+		fmt.Printf("\033[31m❌ Invalid -exclude %v\033[0m\n", err)
+		exit(2)
+	}
+	if scanner.Includes, err = ParseIgnoreOverrides(*includePtr, "-include"); err != nil {
+		fmt.Printf("\033[31m❌ Invalid -include %v\033[0m\n", err)
+		exit(2)
+	}
+	if *excludeContentPtr != "" {
+		if scanner.ExcludeContent, err = regexp.Compile(*excludeContentPtr); err != nil {
+			fmt.Printf("\033[31m❌ Invalid -exclude-content pattern: %v\033[0m\n", err)
+			exit(2)
+		}
+	}
+	if *includeContentPtr != "" {
+		if scanner.IncludeContent, err = regexp.Compile(*includeContentPtr); err != nil {
+			fmt.Printf("\033[31m❌ Invalid -include-content pattern: %v\033[0m\n", err)
+			exit(2)
+		}
+	}
+
+	// Export mode writes the annotated bundle and exits without talking to a model
+	if *exportPtr != "" {
+		scanner.Progress = StartWalkProgress()
+		count, err := ExportContext(scanner, *exportPtr)
+		scanner.Progress.Stop()
+		var readErr *MultiReadError
+		if errors.As(err, &readErr) {
+			fmt.Printf("\033[33m⚠️  %v\033[0m\n", readErr)
+		} else if err != nil {
+			fmt.Printf("\033[31m❌ Export Error: %v\033[0m\n", err)
+			exit(1)
+		}
+		fmt.Printf("\033[32m✅ Exported %d files to %s\033[0m\n", count, *exportPtr)
+		printScanStats(scanner.Stats, scanner.Root, scanner.MaxFilesPerDir)
+		return
+	}
+
+	// Dry-run mode scans like the real index would, then reports and exits
+	if *dryRunPtr {
+		scanner.CountIgnored = true
+		scanner.Progress = StartWalkProgress()
+		index, err := scanner.BuildIndex()
+		scanner.Progress.Stop()
+		var readErr *MultiReadError
+		switch {
+		case err == nil, errors.Is(err, ErrNoFilesMatched):
+		case errors.As(err, &readErr):
+			fmt.Printf("\033[33m⚠️  %v\033[0m\n", readErr)
+		default:
+			fmt.Printf("\033[31m❌ %v\033[0m\n", err)
+			exit(1)
+		}
+		fmt.Printf("\033[32m✅ Would index %d files (~%d tokens if all were sent)\033[0m\n", len(index), indexTokens(index))
+		printScanStats(scanner.Stats, scanner.Root, scanner.MaxFilesPerDir)
+		if *breakdownPtr {
+			printContextBreakdown(index, *breakdownDepthPtr)
+		}
+		printIgnoreSummary(scanner)
+		return
+	}
 
 	// 1. Cargar configuración
 	fmt.Println("\033[36m🔧 Cargando configuración...\033[0m")
@@ -503,15 +2131,9 @@ func main() {
 		config = &Config{DefaultModel: DEFAULT_MODEL}
 	}
 
-	// 2. Inicializar cliente AI temporal para listar modelos
-	tempAI, err := NewAIClient(config.DefaultModel)
-	if err != nil {
-		fmt.Printf("AI Client Error: %v\n", err)
-		return
-	}
-
-	fmt.Println("\033[36m🔍 Conectando con Ollama...\033[0m")
-	models, err := ListModels(tempAI.client)
+	// 2. Conectar con el proveedor para listar modelos
+	fmt.Printf("\033[36m🔍 Conectando con %s...\033[0m\n", provider.Name())
+	models, err := ListModels(provider)
 	if err != nil {
 		// ... existing error handling ...
 	}
@@ -525,16 +2147,26 @@ func main() {
 		}
 	}
 
-	if defaultIdx == -1 {
+	if *modelPtr != "" {
+		if len(models) > 0 && !slices.Contains(models, *modelPtr) {
+			fmt.Printf("\033[33m⚠️  Model '%s' (-model) is not in the list from %s, trying it anyway\033[0m\n", *modelPtr, provider.Name())
+		}
+	} else if _, ok := provider.(*OllamaProvider); !ok && defaultIdx == -1 && len(models) > 0 {
+		// The saved default is an Ollama name; start from what this provider offers
+		fmt.Printf("\033[33m⚠️  Default model '%s' not offered by %s, using %s\033[0m\n", config.DefaultModel, provider.Name(), models[0])
+		config.DefaultModel = models[0]
+	} else if defaultIdx == -1 {
 		fmt.Printf("\033[33m⚠️  Default model '%s' not found in local models.\033[0m\n", config.
 			DefaultModel)
 	} else {
 		fmt.Printf("\033[32m✅ Default model found at index %d\033[0m\n", defaultIdx)
 	}
 
-	// 4. Selección de modelo (si hay más de uno)
+	// 4. Selección de modelo (si hay más de uno, nunca en modo servidor o batch)
 	selectedModel := config.DefaultModel
-	if len(models) > 1 {
+	if *modelPtr != "" {
+		selectedModel = *modelPtr
+	} else if len(models) > 1 && *servePtr == "" && len(questions) == 0 {
 		selectedModel, err = SelectModel(models, config.DefaultModel)
 		if err != nil {
 			fmt.Printf("\033[33m⚠️  Error en selección, usando default\033[0m\n")
@@ -559,39 +2191,205 @@ func main() {
 	}
 
 	// 5. Inicializar componentes con modelo seleccionado
-	scanner, err := NewScanner(*dirPtr, ".gitignore", allowedExtensions)
-	if err != nil {
-		fmt.Printf("Scanner Error: %v\n", err)
-		return
-	}
-
-	ai, err := NewAIClient(selectedModel) // ← Usar modelo seleccionado
-	if err != nil {
-		fmt.Printf("AI Client Error: %v\n", err)
+	ai := NewAIClient(provider, selectedModel) // ← Usar modelo seleccionado
+	ai.RenderCmd = *renderCmdPtr
+	ai.SetRenderWorkers(*renderWorkersPtr)
+	ai.SetWrapWidth(*wrapPtr)
+	ai.System = systemPrompt
+	ai.Endpoint = *endpointPtr
+	ai.Stream = *streamPtr
+	ai.Remind = *repeatSystemPtr
+	ai.HistoryTurns = *historyTurnsPtr
+	ai.SummarizeHistory = *summarizeHistoryPtr
+	ai.MaxContext = scanner.MaxContext
+	ai.Validator = validator
+	ai.Review = review
+
+	if *modelInfoPtr {
+		if err := PrintModelInfo(provider, selectedModel); err != nil {
+			fmt.Printf("\033[31m❌ Model Info Error: %v\033[0m\n", err)
+			exit(1)
+		}
 		return
 	}
 
 	// 6. Build Index
-	fmt.Printf("\033[36m📂 Building Index for %s...\033[0m\n", *dirPtr)
-	index, err := scanner.BuildIndex()
-	if err != nil {
-		fmt.Printf("Index Error: %v\n", err)
-		return
+	var index []FileIndex
+	if *noContextPtr {
+		fmt.Println("\033[36m💬 No-context mode: questions are sent without repository files\033[0m")
+	} else {
+		fmt.Printf("\033[36m📂 Building Index for %s...\033[0m\n", *dirPtr)
+		if checkpoint, err := OpenCheckpoint(scanner.Root, *resumePtr); err != nil {
+			fmt.Printf("\033[33m⚠️  Scan checkpoints disabled: %v\033[0m\n", err)
+		} else {
+			scanner.Checkpoint = checkpoint
+		}
+		scanner.Progress = StartWalkProgress()
+		index, err = scanner.BuildIndex()
+		scanner.Progress.Stop()
+		scanner.Progress = nil
+		var readErr *MultiReadError
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrNoFilesMatched):
+			fmt.Printf("\033[33m⚠️  No files matched the extension and ignore filters in %s\033[0m\n", *dirPtr)
+		case errors.As(err, &readErr):
+			fmt.Printf("\033[33m⚠️  %v\033[0m\n", readErr)
+		case errors.As(err, new(ReadError)):
+			fmt.Printf("\033[31m❌ Scan aborted, cannot read %v\033[0m\n", err)
+			exit(1)
+		case errors.Is(err, ErrScanRoot):
+			fmt.Printf("\033[31m❌ %v\033[0m\n", err)
+			exit(1)
+		default:
+			fmt.Printf("Index Error: %v\n", err)
+			exit(1)
+		}
+		fmt.Printf("\033[32m✅ Indexed %d files (~%d tokens if all were sent)\033[0m\n", len(index), indexTokens(index))
+		printScanStats(scanner.Stats, scanner.Root, scanner.MaxFilesPerDir)
+		if *breakdownPtr {
+			printContextBreakdown(index, *breakdownDepthPtr)
+		}
 	}
-	fmt.Printf("\033[32m✅ Indexed %d files\033[0m\n", len(index))
 
 	// 7. Create Session
 	session := &Session{
-		scanner: scanner,
-		index:   index,
-		ai:      ai,
+		scanner:     scanner,
+		index:       index,
+		ai:          ai,
+		prettyPaths: *prettyPathsPtr,
+		savePath:    *savePtr,
+		tee:         *teePtr,
+		noContext:   *noContextPtr,
+		namesOnly:   *namesOnlyPtr,
+		noRun:       *noRunPtr,
+		dropped:     make(map[string]bool),
+
+		config:        config,
+		noCostWarning: *noCostWarningPtr,
+		pricing:       pricing,
+	}
+	if !*noContextPtr {
+		session.scanned = session.indexStamps()
+	}
+	if resumed != nil {
+		session.sessionName = *sessionPtr
+		session.turns = resumed.Turns
+		if len(resumed.Turns) > 0 {
+			fmt.Printf("\033[32m🗂️  Resumed session %s (%d turns, last %s)\033[0m\n",
+				*sessionPtr, len(resumed.Turns), resumed.Updated.Local().Format("2006-01-02 15:04"))
+		}
+	}
+
+	if *ragPtr && !*noContextPtr && !*namesOnlyPtr && len(index) > 0 {
+		session.embedder = &Embedder{provider: provider, Model: *embedModelPtr}
+		session.rag = LoadRetrievalIndex(scanner.Root, *embedModelPtr, *reindexPtr)
+		session.ragTopK = *ragTopKPtr
+		if err := session.updateRetrieval(context.Background()); err != nil {
+			fmt.Printf("\033[33m⚠️  -rag disabled, selecting files as usual: %v\033[0m\n", err)
+			session.rag = nil
+		}
+	}
+
+	if *gitLogPtr > 0 && !*noContextPtr {
+		if log, err := GitLog(scanner.Root, *gitLogPtr); err != nil {
+			fmt.Printf("\033[33m⚠️  Skipping git log: %v\033[0m\n", err)
+		} else if log != "" {
+			session.gitBlocks += formatGitBlock(fmt.Sprintf("log (last %d commits)", *gitLogPtr), log)
+			fmt.Printf("\033[32m✅ Attached the last %d commits\033[0m\n", *gitLogPtr)
+		}
+	}
+	if !*noContextPtr {
+		var diffs []bool // -diff, -staged: whether each is the staged one
+		if *diffPtr {
+			diffs = append(diffs, false)
+		}
+		if *stagedPtr {
+			diffs = append(diffs, true)
+		}
+		for _, staged := range diffs {
+			label := diffLabel(staged, "")
+			if diff, err := runGit(scanner.Root, diffArgs(staged, "")...); err != nil {
+				fmt.Printf("\033[33m⚠️  Skipping git %s: %v\033[0m\n", label, err)
+			} else if diff == "" {
+				fmt.Printf("\033[36m📝 No changes in git %s\033[0m\n", label)
+			} else {
+				session.gitBlocks += gitBlock(label, diff)
+				fmt.Printf("\033[32m✅ Attached git %s, ~%d tokens\033[0m\n", label, EstimateTokens(diff))
+			}
+		}
+		if *sincePtr != "" {
+			label := "log --patch (commits since " + *sincePtr + ")"
+			if log, err := GitSince(scanner.Root, *sincePtr); err != nil {
+				fmt.Printf("\033[33m⚠️  Skipping -since: %v\033[0m\n", err)
+			} else if log == "" {
+				fmt.Printf("\033[36m📝 No commits since %s\033[0m\n", *sincePtr)
+			} else {
+				session.gitBlocks += gitBlock(label, log)
+				fmt.Printf("\033[32m✅ Attached the commits since %s, ~%d tokens\033[0m\n", *sincePtr, EstimateTokens(log))
+			}
+		}
+	}
+	explicitDiff := *diffPtr || *stagedPtr || *sincePtr != ""
+	if review != "" && !*noContextPtr && !explicitDiff {
+		if diff, err := GitDiff(scanner.Root); err != nil {
+			fmt.Printf("\033[33m⚠️  No git diff to review, reviewing the scanned files: %v\033[0m\n", err)
+		} else if diff == "" {
+			fmt.Println("\033[36m📝 No uncommitted changes, reviewing the scanned files\033[0m")
+		} else {
+			session.gitBlocks += formatGitBlock("diff (uncommitted changes)", diff)
+			fmt.Printf("\033[32m✅ Attached the uncommitted diff for review (~%d tokens)\033[0m\n", EstimateTokens(diff))
+		}
+	}
+
+	// Batch mode: ask the questions (-questions-file, -q or -q-file) in order, then exit
+	if len(questions) > 0 {
+		var confirm *bufio.Scanner
+		if *confirmEachPtr {
+			if stdinIsTerminal() {
+				confirm = bufio.NewScanner(os.Stdin)
+			} else {
+				fmt.Println("\033[33m⚠️  -confirm-each needs a terminal on stdin, running without confirmation\033[0m")
+			}
+		}
+		if oneShot != nil {
+			// Ctrl-C cancels the request and exits non-zero like any failure
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			err := session.AnswerOnce(ctx, questions[0], oneShot)
+			stop()
+			if err != nil {
+				fmt.Printf("\033[31mAI Error: %v\033[0m\n", err)
+				exit(1)
+			}
+			return
+		}
+		if failed := session.RunBatch(questions, confirm); failed > 0 {
+			exit(1)
+		}
+		return
+	}
+
+	// Headless mode: keep the index in memory and answer over HTTP
+	if *servePtr != "" {
+		server := NewServer(session)
+		server.PrettyJSON = *prettyJSONPtr
+		if *embedPtr != "" {
+			server.Embedder = &Embedder{provider: provider, Model: *embedModelPtr, What: *embedPtr}
+		}
+		if err := server.ListenAndServe(*servePtr); err != nil {
+			fmt.Printf("\033[31m❌ Server Error: %v\033[0m\n", err)
+			exit(1)
+		}
+		return
 	}
 
 	// 8. Interactive Loop
 	fmt.Println("\033[90mType 'exit' or 'quit' to close the session.\033[0m")
 	fmt.Println("\033[90mType 'model' to change the current model.\033[0m")
+	fmt.Println("\033[90mType '/help' to list session commands.\033[0m")
 
 	inputScanner := bufio.NewScanner(os.Stdin)
+	emptyInputs := 0
 	for {
 		fmt.Print("\n\033[1;34m❯\033[0m ")
 		if !inputScanner.Scan() {
@@ -605,7 +2403,7 @@ func main() {
 
 		// ← Comando para cambiar modelo
 		if userInput == "model" {
-			newModel, err := SelectModel(models, session.ai.Model)
+			newModel, err := SelectModel(models, session.ai.Model())
 			if err == nil && newModel != "" {
 				session.ChangeModel(newModel)
 				config.DefaultModel = newModel
@@ -615,15 +2413,20 @@ func main() {
 		}
 
 		if userInput == "" {
+			// A few Enters in a row usually mean "what can I do here?"
+			emptyInputs++
+			if *emptyHintPtr > 0 && emptyInputs == *emptyHintPtr {
+				fmt.Println("\033[90m💡 Type a question about the code, /help for session commands, or exit to quit.\033[0m")
+			}
 			continue
 		}
+		emptyInputs = 0
 
-		fmt.Println("\033[90m────────────────────────────────────────────────────────────\033[0m")
-
-		if err := session.AskQuestion(context.Background(), userInput); err != nil {
-			fmt.Printf("\033[31mAI Error: %v\033[0m\n", err)
+		if strings.HasPrefix(userInput, "/") {
+			session.HandleCommand(userInput)
+			continue
 		}
 
-		fmt.Println("\033[90m────────────────────────────────────────────────────────────\033[0m")
+		session.askInteractive(userInput)
 	}
 }
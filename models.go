@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// LATEST_TAG is what Ollama pulls when a model is named without a tag
+const LATEST_TAG = "latest"
+
+// withLatestTag adds ":latest" to a model named without a tag and reports
+// whether it did. Only the last path segment can hold the tag, so a registry
+// port ("host:5000/llama3") is not mistaken for one.
+func withLatestTag(model string) (string, bool) {
+	name := model[strings.LastIndex(model, "/")+1:]
+	if name == "" || strings.Contains(name, ":") {
+		return model, false
+	}
+	return model + ":" + LATEST_TAG, true
+}
+
+// isModelNotFound reports whether Ollama rejected a request for a model it
+// doesn't have
+func isModelNotFound(err error) bool {
+	var statusErr api.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound &&
+		strings.Contains(strings.ToLower(statusErr.ErrorMessage), "not found")
+}
+
+// switchModel handles /model: with no argument it lists the models the
+// provider offers, otherwise it switches to the one named or numbered for
+// the rest of the session (the saved default is left alone)
+func (s *Session) switchModel(arg string) {
+	models, err := ListModels(s.ai.provider)
+	if err != nil {
+		fmt.Printf("\033[33m⚠️  Cannot list models from %s: %v\033[0m\n", s.ai.provider.Name(), err)
+	}
+
+	if arg == "" {
+		if len(models) == 0 {
+			fmt.Printf("\033[90mCurrent model: %s. Usage: /model <name>\033[0m\n", s.ai.Model())
+			return
+		}
+		fmt.Printf("\033[36m📋 Models from %s:\033[0m\n", s.ai.provider.Name())
+		for i, m := range models {
+			current := ""
+			if m == s.ai.Model() {
+				current = " \033[32m(current)\033[0m"
+			}
+			fmt.Printf("   \033[90m[%d]\033[0m %s%s\n", i+1, m, current)
+		}
+		fmt.Println("\033[90mSwitch with /model <number|name>.\033[0m")
+		return
+	}
+
+	model := arg
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n < 1 || n > len(models) {
+			fmt.Printf("\033[31m❌ No model number %d (try /model)\033[0m\n", n)
+			return
+		}
+		model = models[n-1]
+	} else if len(models) > 0 && !slices.Contains(models, model) {
+		fmt.Printf("\033[33m⚠️  %s is not in the list from %s, trying it anyway\033[0m\n", model, s.ai.provider.Name())
+	}
+	s.ChangeModel(model)
+}
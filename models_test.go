@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestWithLatestTag(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		added    bool
+	}{
+		{"qwen3.5", "qwen3.5:latest", true},
+		{"qwen3.5:latest", "qwen3.5:latest", false},
+		{"llama3:8b", "llama3:8b", false},
+		{"library/llama3", "library/llama3:latest", true},
+		{"host:5000/llama3", "host:5000/llama3:latest", true},
+		{"host:5000/team/llama3:q4", "host:5000/team/llama3:q4", false},
+		{"trailing/", "trailing/", false},
+		{"", "", false},
+	} {
+		got, added := withLatestTag(tc.in)
+		if got != tc.want || added != tc.added {
+			t.Errorf("withLatestTag(%q) = %q, %v; want %q, %v", tc.in, got, added, tc.want, tc.added)
+		}
+	}
+}
+
+// latestOnlyProvider knows its model only by the ':latest' name, like an
+// Ollama server does for a model pulled without a tag
+type latestOnlyProvider struct {
+	mockProvider
+	models []string
+}
+
+func (p *latestOnlyProvider) Chat(ctx context.Context, model string, messages []api.Message, stream bool, onChunk func(string) error) (Completion, error) {
+	p.mu.Lock()
+	p.models = append(p.models, model)
+	p.mu.Unlock()
+	if !strings.HasSuffix(model, ":latest") {
+		return Completion{}, api.StatusError{StatusCode: http.StatusNotFound, ErrorMessage: "model \"" + model + "\" not found"}
+	}
+	return p.mockProvider.Chat(ctx, model, messages, stream, onChunk)
+}
+
+func TestSelectionRetriesWithLatestTag(t *testing.T) {
+	provider := &latestOnlyProvider{mockProvider: mockProvider{Select: []string{"a.go"}}}
+	session := newTestSession(t, map[string]string{"a.go": "package main\n"}, provider)
+	session.ai.UpdateModel("qwen3.5")
+
+	var paths []string
+	var err error
+	output := captureStdout(t, func() {
+		paths, err = session.selectRelevantFiles(context.Background(), "what is a.go?")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(paths, []string{"a.go"}) {
+		t.Errorf("selected %v, want [a.go]", paths)
+	}
+	if want := []string{"qwen3.5", "qwen3.5:latest"}; !slices.Equal(provider.models, want) {
+		t.Errorf("requested models %v, want %v", provider.models, want)
+	}
+	if got := session.ai.Model(); got != "qwen3.5:latest" {
+		t.Errorf("model is %q after the retry, want qwen3.5:latest", got)
+	}
+	if !strings.Contains(output, "retrying as 'qwen3.5:latest'") {
+		t.Errorf("no retry notice in %q", output)
+	}
+}
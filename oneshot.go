@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Values of -format
+const (
+	FORMAT_PLAIN    = "plain"
+	FORMAT_MARKDOWN = "markdown"
+	FORMAT_JSON     = "json"
+)
+
+// OneShot is a single -q question answered for a script: everything the
+// session prints goes to stderr (without colors unless stderr is a
+// terminal) and only the answer, in Format, is written to stdout
+type OneShot struct {
+	Format string
+	Out    *os.File // The real stdout
+
+	status    *os.File // Write end of the pipe standing in for os.Stdout
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// StartOneShot redirects os.Stdout to stderr until Close. It returns nil
+// when format is empty and stdout is a terminal: the answer is rendered as
+// in interactive mode. Without -format, piped stdout gets raw Markdown.
+func StartOneShot(format string) (*OneShot, error) {
+	if format == "" {
+		if stdoutIsTerminal() {
+			return nil, nil
+		}
+		format = FORMAT_MARKDOWN
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	o := &OneShot{Format: format, Out: os.Stdout, status: w, done: make(chan struct{})}
+	color := term.IsTerminal(int(os.Stderr.Fd()))
+	go func() {
+		defer close(o.done)
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadString('\n')
+			if !color {
+				line = StripANSI(line)
+			}
+			os.Stderr.WriteString(line)
+			if err != nil {
+				return
+			}
+		}
+	}()
+	os.Stdout = w
+	return o, nil
+}
+
+// Close restores os.Stdout and flushes the status lines still in the pipe
+func (o *OneShot) Close() {
+	o.closeOnce.Do(func() {
+		os.Stdout = o.Out
+		o.status.Close()
+		<-o.done
+	})
+}
+
+// oneShotResult is the -format json output
+type oneShotResult struct {
+	Answer           string   `json:"answer"`
+	Model            string   `json:"model"`
+	Files            []string `json:"files"`
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	DurationMs       int64    `json:"duration_ms"`
+	CostUSD          *float64 `json:"cost_usd,omitempty"` // Set when -price is given
+	Error            string   `json:"error,omitempty"`
+}
+
+// ReadStdinQuestion reads a question piped to stdin
+func ReadStdinQuestion() (string, error) {
+	if stdinIsTerminal() {
+		return "", fmt.Errorf("stdin is a terminal, pipe the question in or use -q")
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// AnswerOnce asks question and writes the answer to o.Out in o.Format.
+// With -format json a failure is written too, as an object with "error".
+func (s *Session) AnswerOnce(ctx context.Context, question string, o *OneShot) error {
+	start := time.Now()
+	result := oneShotResult{Model: s.ai.Model(), Files: []string{}}
+	err := s.answerOnce(ctx, question, o, &result)
+	result.Model = s.ai.Model() // -q may have retried with the :latest tag
+	result.DurationMs = time.Since(start).Milliseconds()
+	if o.Format == FORMAT_JSON {
+		if err != nil {
+			result.Error = err.Error()
+		}
+		encoder := json.NewEncoder(o.Out)
+		encoder.SetIndent("", "  ")
+		if encErr := encoder.Encode(result); encErr != nil && err == nil {
+			err = encErr
+		}
+	}
+	return err
+}
+
+func (s *Session) answerOnce(ctx context.Context, question string, o *OneShot, result *oneShotResult) error {
+	s.warnCloudCost() // before the selection round, which sends the index
+	paths, repoContext, err := s.selectContext(ctx, question)
+	if err != nil {
+		return err
+	}
+	s.lastPaths = paths
+	result.Files = append(result.Files, s.lastPaths...)
+	fmt.Printf("\033[90m📦 %d files loaded into context, %s\033[0m\n", len(s.lastPaths), formatContextTokens(EstimateTokens(repoContext), s.scanner.MaxContext))
+
+	// Raw Markdown can go out as it arrives; the other formats need the whole answer
+	var onChunk func(string) error
+	if o.Format == FORMAT_MARKDOWN && s.ai.Stream {
+		onChunk = func(chunk string) error {
+			_, err := o.Out.WriteString(chunk)
+			return err
+		}
+	}
+
+	question = s.withAttachments(question)
+	completion, err := s.ai.answer(ctx, repoContext, question, onChunk)
+	if err != nil {
+		return err
+	}
+	result.Answer = completion.Answer
+	result.PromptTokens = completion.PromptTokens
+	result.CompletionTokens = completion.CompletionTokens
+	if s.pricing != nil {
+		cost := s.pricing.Cost(completion.PromptTokens, completion.CompletionTokens)
+		s.totalCost += cost
+		result.CostUSD = &cost
+	}
+
+	switch {
+	case o.Format == FORMAT_PLAIN:
+		fmt.Fprintln(o.Out, plainText(s.ai.render(completion.Answer)))
+	case o.Format == FORMAT_MARKDOWN && onChunk == nil:
+		fmt.Fprintln(o.Out, strings.TrimSpace(completion.Answer))
+	case o.Format == FORMAT_MARKDOWN:
+		fmt.Fprintln(o.Out)
+	}
+
+	s.turns = append(s.turns, Turn{Question: question, Answer: completion.Answer, Time: time.Now(), Tags: s.pendingTags})
+	s.pendingTags = nil
+	s.persist()
+	return nil
+}
+
+// plainText turns a render into plain text: no escape sequences, no
+// trailing padding and no left margin
+func plainText(rendered string) string {
+	lines := strings.Split(strings.Trim(StripANSI(rendered), "\n"), "\n")
+	margin := -1
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+		if lines[i] == "" {
+			continue
+		}
+		indent := len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+		if margin < 0 || indent < margin {
+			margin = indent
+		}
+	}
+	for i, line := range lines {
+		if len(line) >= margin && margin > 0 {
+			lines[i] = line[margin:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// answer returns the completion for question without printing it. With
+// onChunk set and no validator the answer is streamed to it.
+func (ai *AIClient) answer(ctx context.Context, repoContext string, question string, onChunk func(string) error) (Completion, error) {
+	ai.termMu.Lock()
+	defer ai.termMu.Unlock()
+
+	ai.addContext(repoContext)
+	if onChunk != nil && ai.Validator == nil {
+		return ai.chat(ctx, ai.conversation(question), true, onChunk)
+	}
+	completion, _, err := ai.completeValidated(ctx, question)
+	return completion, err
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// OPENAI_BASE_URL is used by -provider openai without -base-url or OPENAI_BASE_URL
+const OPENAI_BASE_URL = "https://api.openai.com/v1"
+
+// SSE_MAX_LINE bounds one line of a server-sent event stream
+const SSE_MAX_LINE = 1 << 20
+
+// OpenAIProvider talks to any server implementing OpenAI's
+// /chat/completions, /embeddings and /models (OpenAI, LiteLLM, vLLM,
+// llama.cpp, LM Studio, ...). BaseURL includes the version, e.g.
+// http://localhost:4000/v1.
+type OpenAIProvider struct {
+	BaseURL string
+	APIKey  string // Sent as a bearer token when set
+}
+
+func (p *OpenAIProvider) Name() string { return "OpenAI-compatible API at " + p.BaseURL }
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type openAIChatRequest struct {
+	Model         string          `json:"model"`
+	Messages      []openAIMessage `json:"messages"`
+	Stream        bool            `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+}
+
+// openAIChatResponse is a whole response or, streamed, one chunk of it
+type openAIChatResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+		Delta   openAIMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// Chat runs one /chat/completions request; streamed answers are read as
+// server-sent events, asking for usage in the last one
+func (p *OpenAIProvider) Chat(ctx context.Context, model string, messages []api.Message, stream bool, onChunk func(string) error) (Completion, error) {
+	req := openAIChatRequest{Model: model, Stream: stream}
+	for _, msg := range messages {
+		req.Messages = append(req.Messages, openAIMessage{Role: msg.Role, Content: msg.Content})
+	}
+	if stream {
+		req.StreamOptions = &struct {
+			IncludeUsage bool `json:"include_usage"`
+		}{IncludeUsage: true}
+	}
+
+	start := time.Now()
+	body, err := p.post(ctx, "/chat/completions", req)
+	if err != nil {
+		return Completion{}, err
+	}
+	defer body.Close()
+
+	var result Completion
+	addUsage := func(usage *openAIUsage) {
+		if usage != nil {
+			result.PromptTokens = usage.PromptTokens
+			result.CompletionTokens = usage.CompletionTokens
+		}
+	}
+	if !stream {
+		var res openAIChatResponse
+		if err := json.NewDecoder(body).Decode(&res); err != nil {
+			return Completion{}, fmt.Errorf("decoding the response: %w", err)
+		}
+		if len(res.Choices) > 0 {
+			result.Answer = res.Choices[0].Message.Content
+		}
+		addUsage(res.Usage)
+		result.Duration = time.Since(start)
+		return result, nil
+	}
+
+	var fullResponse strings.Builder
+	err = readEvents(ctx, body, func(data string) error {
+		if data == "[DONE]" {
+			return io.EOF
+		}
+		var chunk openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("decoding a stream chunk: %w", err)
+		}
+		addUsage(chunk.Usage)
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			return nil
+		}
+		content := chunk.Choices[0].Delta.Content
+		fullResponse.WriteString(content)
+		if onChunk != nil {
+			return onChunk(content)
+		}
+		return nil
+	})
+	if err != nil {
+		return Completion{}, err
+	}
+	result.Answer = fullResponse.String()
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// Embed runs one /embeddings request
+func (p *OpenAIProvider) Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	body, err := p.post(ctx, "/embeddings", map[string]any{"model": model, "input": inputs})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var res struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("decoding the response: %w", err)
+	}
+	vectors := make([][]float32, len(res.Data))
+	for _, d := range res.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// Models lists the ids returned by /models
+func (p *OpenAIProvider) Models(ctx context.Context) ([]string, error) {
+	body, err := p.do(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return decodeModelIDs(body)
+}
+
+func (p *OpenAIProvider) post(ctx context.Context, path string, payload any) (io.ReadCloser, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return p.do(ctx, http.MethodPost, path, data)
+}
+
+func (p *OpenAIProvider) do(ctx context.Context, method string, path string, payload []byte) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	return sendHTTP(req)
+}
+
+// sendHTTP runs req and returns the body of a 2xx response; other statuses
+// become a *ProviderError with the message from the usual
+// {"error": {"message": ...}} body when there is one
+func sendHTTP(req *http.Request) (io.ReadCloser, error) {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 == 2 {
+		return res.Body, nil
+	}
+	defer res.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	message := strings.TrimSpace(string(data))
+	if json.Unmarshal(data, &body) == nil && len(body.Error) > 0 {
+		var detail struct {
+			Message string `json:"message"`
+		}
+		var text string
+		switch {
+		case json.Unmarshal(body.Error, &detail) == nil && detail.Message != "":
+			message = detail.Message
+		case json.Unmarshal(body.Error, &text) == nil && text != "":
+			message = text
+		}
+	}
+	return nil, &ProviderError{StatusCode: res.StatusCode, Message: message}
+}
+
+// decodeModelIDs reads a {"data": [{"id": ...}]} model list
+func decodeModelIDs(body io.Reader) ([]string, error) {
+	var res struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("decoding the model list: %w", err)
+	}
+	models := make([]string, 0, len(res.Data))
+	for _, m := range res.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// readEvents calls onData with the data of each server-sent event until
+// the stream ends or onData returns io.EOF (a normal end) or another error
+func readEvents(ctx context.Context, body io.Reader, onData func(data string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64<<10), SSE_MAX_LINE)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue // event names, comments and keep-alives
+		}
+		if err := onData(strings.TrimSpace(data)); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ORDER_PINNED_FIRST keeps the files in the order they were chosen: pinned
+// files, then the model's picks
+const ORDER_PINNED_FIRST = "pinned-first"
+
+// contextOrders maps -context-order names to strategies. Each one reorders
+// a group of files and returns a new slice.
+var contextOrders = map[string]func(root string, files []FileContent) []FileContent{
+	ORDER_PINNED_FIRST: func(_ string, files []FileContent) []FileContent { return files },
+	"path":             orderByPath,
+	"recent":           orderByRecent,
+	"package":          orderByPackage,
+	"topo":             orderTopological,
+}
+
+// ContextOrderNames returns the valid -context-order values, sorted
+func ContextOrderNames() []string {
+	names := make([]string, 0, len(contextOrders))
+	for name := range contextOrders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OrderFiles applies the named strategy. Pinned files always stay ahead of
+// the rest (each group is ordered on its own), and /focus is applied
+// afterwards, so the precedence is: focus, then pins, then the strategy.
+func OrderFiles(strategy string, root string, files []FileContent, pinned func(path string) bool) []FileContent {
+	order, ok := contextOrders[strategy]
+	if !ok {
+		order = contextOrders[ORDER_PINNED_FIRST]
+	}
+
+	var head, rest []FileContent
+	for _, fc := range files {
+		if pinned != nil && pinned(fc.Path) {
+			head = append(head, fc)
+		} else {
+			rest = append(rest, fc)
+		}
+	}
+	return append(order(root, head), order(root, rest)...)
+}
+
+func orderByPath(_ string, files []FileContent) []FileContent {
+	sorted := slices.Clone(files)
+	slices.SortStableFunc(sorted, func(a, b FileContent) int { return strings.Compare(a.Path, b.Path) })
+	return sorted
+}
+
+// orderByRecent puts the most recently modified files first
+func orderByRecent(root string, files []FileContent) []FileContent {
+	modTimes := make(map[string]time.Time, len(files))
+	for _, fc := range files {
+		path := fc.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+		if info, err := os.Stat(path); err == nil {
+			modTimes[fc.Path] = info.ModTime()
+		}
+	}
+	sorted := slices.Clone(files)
+	slices.SortStableFunc(sorted, func(a, b FileContent) int { return modTimes[b.Path].Compare(modTimes[a.Path]) })
+	return sorted
+}
+
+// orderByPackage groups files by directory, keeping the groups in the order
+// their first file appeared
+func orderByPackage(_ string, files []FileContent) []FileContent {
+	var dirs []string
+	groups := make(map[string][]FileContent)
+	for _, fc := range files {
+		dir := filepath.Dir(fc.Path)
+		if _, ok := groups[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		groups[dir] = append(groups[dir], fc)
+	}
+
+	var grouped []FileContent
+	for _, dir := range dirs {
+		grouped = append(grouped, groups[dir]...)
+	}
+	return grouped
+}
+
+// goImport matches a quoted path on an import line or inside an import block
+var goImport = regexp.MustCompile(`(?m)^\s*(?:import\s+)?(?:[\w.]+\s+)?"([^"]+)"\s*$`)
+
+// orderTopological puts dependencies before the files that import them:
+// Go files after the packages they import from the repo, TS/JS files after
+// their relative imports. Ties and cycles keep the incoming order.
+func orderTopological(root string, files []FileContent) []FileContent {
+	deps := make([][]int, len(files))
+	for i, fc := range files {
+		for j, other := range files {
+			if i != j && imports(root, fc, other.Path) {
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+
+	emitted := make([]bool, len(files))
+	ordered := make([]FileContent, 0, len(files))
+	for len(ordered) < len(files) {
+		next := -1
+		for i := range files {
+			if emitted[i] {
+				continue
+			}
+			if next < 0 {
+				next = i // Fallback for cycles: the first file left
+			}
+			if !slices.ContainsFunc(deps[i], func(j int) bool { return !emitted[j] }) {
+				next = i
+				break
+			}
+		}
+		emitted[next] = true
+		ordered = append(ordered, files[next])
+	}
+	return ordered
+}
+
+// imports reports whether fc imports the file at target
+func imports(root string, fc FileContent, target string) bool {
+	switch filepath.Ext(fc.Path) {
+	case ".go":
+		if filepath.Ext(target) != ".go" || filepath.Dir(target) == filepath.Dir(fc.Path) {
+			return false
+		}
+		rel := filepath.Dir(target)
+		if filepath.IsAbs(rel) {
+			var err error
+			if rel, err = filepath.Rel(root, rel); err != nil {
+				return false
+			}
+		}
+		if rel == "." {
+			return false
+		}
+		rel = filepath.ToSlash(rel)
+		for _, m := range goImport.FindAllStringSubmatch(fc.Content, -1) {
+			if m[1] == rel || strings.HasSuffix(m[1], "/"+rel) {
+				return true
+			}
+		}
+	default:
+		if !scriptExts[filepath.Ext(fc.Path)] && filepath.Ext(fc.Path) != ".svelte" {
+			return false
+		}
+		trimmedTarget := strings.TrimSuffix(target, filepath.Ext(target))
+		for _, m := range importSpecifier.FindAllStringSubmatch(fc.Content, -1) {
+			if !strings.HasPrefix(m[1], ".") {
+				continue
+			}
+			spec := filepath.Join(filepath.Dir(fc.Path), m[1])
+			for _, candidate := range []string{spec, strings.TrimSuffix(spec, filepath.Ext(spec))} {
+				if candidate == target || candidate == trimmedTarget || filepath.Join(candidate, "index") == trimmedTarget {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PRETTY_KEEP_DIRS is how many trailing directories stay unabbreviated
+const PRETTY_KEEP_DIRS = 2
+
+// AbbreviatePaths shortens the leading directories of each path to their
+// first letter, e.g. services/foo/internal/handlers/v2/user_handler.go
+// becomes s/f/i/handlers/v2/user_handler.go. It returns the display path
+// for every abbreviated input and a legend mapping each abbreviated prefix
+// back to the full directory. Paths whose abbreviation would be ambiguous
+// are left untouched.
+func AbbreviatePaths(paths []string) (map[string]string, map[string]string) {
+	display := make(map[string]string)
+	legend := make(map[string]string)
+	ambiguous := make(map[string]bool)
+
+	type split struct {
+		path, abbr, full, rest string
+	}
+	var candidates []split
+
+	for _, p := range paths {
+		parts := strings.Split(filepath.ToSlash(p), "/")
+		dirs := len(parts) - 1
+		if dirs <= PRETTY_KEEP_DIRS {
+			continue
+		}
+
+		cut := dirs - PRETTY_KEEP_DIRS
+		short := make([]string, cut)
+		for i, part := range parts[:cut] {
+			short[i] = abbreviateSegment(part)
+		}
+
+		c := split{
+			path: p,
+			abbr: strings.Join(short, "/"),
+			full: strings.Join(parts[:cut], "/"),
+			rest: strings.Join(parts[cut:], "/"),
+		}
+		if existing, ok := legend[c.abbr]; ok && existing != c.full {
+			ambiguous[c.abbr] = true
+		}
+		legend[c.abbr] = c.full
+		candidates = append(candidates, c)
+	}
+
+	for abbr := range ambiguous {
+		delete(legend, abbr)
+	}
+	for _, c := range candidates {
+		if !ambiguous[c.abbr] {
+			display[c.path] = c.abbr + "/" + c.rest
+		}
+	}
+
+	return display, legend
+}
+
+// abbreviateSegment keeps the first letter of a directory name, preserving a
+// leading dot so hidden directories stay recognizable
+func abbreviateSegment(segment string) string {
+	runes := []rune(segment)
+	if len(runes) > 1 && runes[0] == '.' {
+		return string(runes[:2])
+	}
+	if len(runes) == 0 {
+		return segment
+	}
+	return string(runes[:1])
+}
+
+// formatPathLegend renders the abbreviation legend placed before the FILE blocks
+func formatPathLegend(legend map[string]string) string {
+	keys := make([]string, 0, len(legend))
+	for abbr := range legend {
+		keys = append(keys, abbr)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("PATH LEGEND (abbreviated directories in FILE headers):\n")
+	for _, abbr := range keys {
+		fmt.Fprintf(&b, "%s/ = %s/\n", abbr, legend[abbr])
+	}
+	return b.String()
+}
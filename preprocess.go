@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PREPROCESS_TIMEOUT bounds one -preprocess command on one file
+const PREPROCESS_TIMEOUT = 30 * time.Second
+
+// PREPROCESS_ALL is the Preprocessors key of the command for every extension
+const PREPROCESS_ALL = "*"
+
+// preprocessedKey is the content cache key of a file's preprocessed content,
+// kept apart from the raw content cached under its path
+func preprocessedKey(path string) string { return path + "\x00preprocessed" }
+
+// ParsePreprocessors reads -preprocess: either one command for every file
+// ("sed -e ...") or comma-separated ext=command pairs
+// (".go=gofmt,.enc=sops -d /dev/stdin"), where "*=command" covers the
+// extensions without their own entry
+func ParsePreprocessors(spec string) (map[string]string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	entries := strings.Split(spec, ",")
+	isPair := func(entry string) bool {
+		ext, command, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		return ok && (ext == PREPROCESS_ALL || (strings.HasPrefix(ext, ".") && !strings.ContainsAny(ext, " \t"))) && strings.TrimSpace(command) != ""
+	}
+	if !isPair(entries[0]) {
+		return map[string]string{PREPROCESS_ALL: spec}, nil
+	}
+
+	preprocessors := make(map[string]string)
+	for _, entry := range entries {
+		if !isPair(entry) {
+			return nil, fmt.Errorf("%q is not ext=command (e.g. .go=gofmt)", strings.TrimSpace(entry))
+		}
+		ext, command, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if _, dup := preprocessors[ext]; dup {
+			return nil, fmt.Errorf("%s has more than one command", ext)
+		}
+		preprocessors[ext] = strings.TrimSpace(command)
+	}
+	return preprocessors, nil
+}
+
+// preprocessor returns the command for path, "" when its extension has none
+func (s *FileScanner) preprocessor(path string) string {
+	_, entry, isEntry := splitArchivePath(path)
+	if isEntry {
+		path = entry
+	}
+	if command, ok := s.Preprocessors[filepath.Ext(path)]; ok {
+		return command
+	}
+	return s.Preprocessors[PREPROCESS_ALL]
+}
+
+// preprocess pipes content through the -preprocess command for path and
+// returns its stdout. Results for files on disk are cached until the file
+// changes. A failing command is returned as an error, so the file is
+// reported like an unreadable one instead of being sent unprocessed.
+func (s *FileScanner) preprocess(path string, content string) (string, error) {
+	command := s.preprocessor(path)
+	if command == "" {
+		return content, nil
+	}
+
+	var modTime time.Time
+	if _, _, isEntry := splitArchivePath(path); !isEntry && s.cache != nil {
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+			if cached, ok := s.cache.lookup(preprocessedKey(path), modTime); ok {
+				return cached, nil
+			}
+		}
+	}
+
+	out, err := runPreprocessor(s.Root, command, path, content)
+	if err != nil {
+		return "", err
+	}
+	if !modTime.IsZero() {
+		s.cache.store(preprocessedKey(path), modTime, out)
+	}
+	return out, nil
+}
+
+// runPreprocessor runs command with sh in dir, content on stdin and the file's
+// path in $VIBER_FILE
+func runPreprocessor(dir string, command string, path string, content string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), PREPROCESS_TIMEOUT)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "VIBER_FILE="+path)
+	cmd.Stdin = strings.NewReader(content)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("timed out after %s", PREPROCESS_TIMEOUT)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			first, _, _ := strings.Cut(msg, "\n")
+			return "", fmt.Errorf("-preprocess %q: %v: %s", command, err, first)
+		}
+		return "", fmt.Errorf("-preprocess %q: %v", command, err)
+	}
+	return stdout.String(), nil
+}
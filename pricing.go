@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Pricing holds per-million-token prices for a metered model (-price)
+type Pricing struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// ParsePricing reads a -price value like "in=0.5,out=1.5"
+func ParsePricing(spec string) (*Pricing, error) {
+	p := &Pricing{}
+	for _, part := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=value, got %q", part)
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || price < 0 {
+			return nil, fmt.Errorf("invalid price %q for %s", value, key)
+		}
+		switch strings.TrimSpace(key) {
+		case "in", "input":
+			p.InputPerMillion = price
+		case "out", "output":
+			p.OutputPerMillion = price
+		default:
+			return nil, fmt.Errorf("unknown price key %q (use in and out)", key)
+		}
+	}
+	return p, nil
+}
+
+// Cost returns the estimated price of a request in the pricing's currency
+func (p *Pricing) Cost(promptTokens int, completionTokens int) float64 {
+	return (float64(promptTokens)*p.InputPerMillion + float64(completionTokens)*p.OutputPerMillion) / 1e6
+}
+
+// formatCost prints small amounts with enough digits to be meaningful
+func formatCost(cost float64) string {
+	if cost < 0.01 {
+		return fmt.Sprintf("$%.5f", cost)
+	}
+	return fmt.Sprintf("$%.4f", cost)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WalkProgress redraws one status line with a spinner and the directory the
+// walk is in. The walk only stores the latest directory; a ticker does the
+// drawing so slow terminals never slow the scan down.
+type WalkProgress struct {
+	mu   sync.Mutex
+	dir  string
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// StartWalkProgress begins drawing, or returns nil when stdout is not a
+// terminal. A nil *WalkProgress is safe to use.
+func StartWalkProgress() *WalkProgress {
+	if terminalWidth() <= 0 {
+		return nil
+	}
+	p := &WalkProgress{done: make(chan struct{})}
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+// SetDir records the directory being walked
+func (p *WalkProgress) SetDir(dir string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.dir = dir
+	p.mu.Unlock()
+}
+
+// Stop clears the status line
+func (p *WalkProgress) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	p.wg.Wait()
+}
+
+func (p *WalkProgress) run() {
+	defer p.wg.Done()
+	frames := []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for i := 0; ; i = (i + 1) % len(frames) {
+		select {
+		case <-p.done:
+			fmt.Print("\r\033[K")
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			dir := p.dir
+			p.mu.Unlock()
+			fmt.Printf("\r\033[K\033[35m%s\033[0m \033[90m%s\033[0m", frames[i], fitWidth(dir, terminalWidth()-3))
+		}
+	}
+}
+
+// fitWidth shortens s to width runes, keeping the end (the deepest
+// directory) and marking the cut with an ellipsis
+func fitWidth(s string, width int) string {
+	runes := []rune(s)
+	if width <= 1 || len(runes) <= width {
+		return s
+	}
+	return "…" + string(runes[len(runes)-width+1:])
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const PROJECT_CONFIG_FILE = ".viber.yaml"
+
+// USER_CONFIG_DIR and USER_CONFIG_FILE locate the personal defaults,
+// ~/.config/viber/config.yaml, in the same format as .viber.yaml
+const USER_CONFIG_DIR = "viber"
+const USER_CONFIG_FILE = "config.yaml"
+
+// UserConfigPath returns the personal config file if there is one
+func UserConfigPath() (string, bool) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", false
+	}
+	path := filepath.Join(home, ".config", USER_CONFIG_DIR, USER_CONFIG_FILE)
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return "", false
+	}
+	return path, true
+}
+
+// FindProjectConfig walks up from dir looking for the nearest .viber.yaml,
+// the same way git looks for .git
+func FindProjectConfig(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	for {
+		candidate := filepath.Join(dir, PROJECT_CONFIG_FILE)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// ApplyProjectConfig sets every flag named in the config file that was not
+// set yet, on the command line or by a config applied before. Keys are flag
+// names, lists are joined with commas and a relative "dir" is resolved
+// against the directory holding the config file.
+func ApplyProjectConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]any)
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if flag.Lookup(key) == nil {
+			fmt.Printf("\033[33m⚠️  Unknown option '%s' in %s\033[0m\n", key, path)
+			continue
+		}
+		if explicit[key] {
+			continue
+		}
+
+		value := formatConfigValue(values[key])
+		if key == "dir" && !filepath.IsAbs(value) {
+			value = filepath.Join(filepath.Dir(path), value)
+		}
+		if err := flag.Set(key, value); err != nil {
+			return fmt.Errorf("%s: invalid value for %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// formatConfigValue turns a YAML value into the string form flag.Set expects
+func formatConfigValue(value any) string {
+	switch v := value.(type) {
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ",")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
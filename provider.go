@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Values of -provider
+const (
+	PROVIDER_OLLAMA    = "ollama"
+	PROVIDER_OPENAI    = "openai" // Any OpenAI-compatible /v1/chat/completions server (LiteLLM, vLLM, ...)
+	PROVIDER_ANTHROPIC = "anthropic"
+)
+
+// Provider is an LLM backend. Messages use Ollama's type, the one the rest
+// of viber builds conversations with; roles are system, user and assistant.
+type Provider interface {
+	// Name describes the backend in status lines
+	Name() string
+	// Chat sends the conversation; with stream set, onChunk receives the
+	// answer as it arrives and an error from it aborts the request
+	Chat(ctx context.Context, model string, messages []api.Message, stream bool, onChunk func(string) error) (Completion, error)
+	// Embed returns one vector per input, in order
+	Embed(ctx context.Context, model string, inputs []string) ([][]float32, error)
+	// Models lists the model names the backend offers
+	Models(ctx context.Context) ([]string, error)
+}
+
+// ProviderOptions selects and configures a Provider (-provider, -base-url,
+// -api-key); empty fields fall back to the environment
+type ProviderOptions struct {
+	Name    string
+	BaseURL string
+	APIKey  string
+}
+
+// Environment variables read by NewProvider when the flags are empty
+const (
+	ENV_PROVIDER = "VIBER_PROVIDER"
+	ENV_BASE_URL = "VIBER_BASE_URL"
+	ENV_API_KEY  = "VIBER_API_KEY"
+)
+
+// NewProvider builds the backend for opts. Unset options come from
+// VIBER_PROVIDER, VIBER_BASE_URL and VIBER_API_KEY, then from the backend's
+// usual variables: OLLAMA_HOST, OPENAI_BASE_URL and OPENAI_API_KEY, or
+// ANTHROPIC_BASE_URL and ANTHROPIC_API_KEY.
+func NewProvider(opts ProviderOptions) (Provider, error) {
+	name := strings.ToLower(firstNonEmpty(opts.Name, os.Getenv(ENV_PROVIDER), PROVIDER_OLLAMA))
+	baseURL := firstNonEmpty(opts.BaseURL, os.Getenv(ENV_BASE_URL))
+	apiKey := firstNonEmpty(opts.APIKey, os.Getenv(ENV_API_KEY))
+
+	switch name {
+	case PROVIDER_OLLAMA:
+		if baseURL == "" {
+			client, err := api.ClientFromEnvironment()
+			if err != nil {
+				return nil, err
+			}
+			return &OllamaProvider{client: client}, nil
+		}
+		base, err := url.Parse(baseURL)
+		if err != nil || base.Scheme == "" || base.Host == "" {
+			return nil, fmt.Errorf("invalid base URL %q (use e.g. http://localhost:11434)", baseURL)
+		}
+		return &OllamaProvider{client: api.NewClient(base, http.DefaultClient)}, nil
+	case PROVIDER_OPENAI:
+		return &OpenAIProvider{
+			BaseURL: strings.TrimRight(firstNonEmpty(baseURL, os.Getenv("OPENAI_BASE_URL"), OPENAI_BASE_URL), "/"),
+			APIKey:  firstNonEmpty(apiKey, os.Getenv("OPENAI_API_KEY")),
+		}, nil
+	case PROVIDER_ANTHROPIC:
+		key := firstNonEmpty(apiKey, os.Getenv("ANTHROPIC_API_KEY"))
+		if key == "" {
+			return nil, fmt.Errorf("the anthropic provider needs an API key (-api-key or ANTHROPIC_API_KEY)")
+		}
+		return &AnthropicProvider{
+			BaseURL: strings.TrimRight(firstNonEmpty(baseURL, os.Getenv("ANTHROPIC_BASE_URL"), ANTHROPIC_BASE_URL), "/"),
+			APIKey:  key,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q (use %s, %s or %s)", name, PROVIDER_OLLAMA, PROVIDER_OPENAI, PROVIDER_ANTHROPIC)
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ProviderError is a request an HTTP backend answered with an error status
+type ProviderError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ProviderError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// OllamaProvider talks to an Ollama server through its Go client
+type OllamaProvider struct {
+	client *api.Client
+}
+
+func (p *OllamaProvider) Name() string { return "Ollama" }
+
+// Chat runs one /api/chat request
+func (p *OllamaProvider) Chat(ctx context.Context, model string, messages []api.Message, stream bool, onChunk func(string) error) (Completion, error) {
+	var fullResponse strings.Builder
+	var result Completion
+	req := &api.ChatRequest{
+		Model:    model,
+		Messages: messages,
+		Stream:   &stream,
+	}
+
+	err := p.client.Chat(ctx, req, func(res api.ChatResponse) error {
+		fullResponse.WriteString(res.Message.Content)
+		if res.Done {
+			result.PromptTokens = res.PromptEvalCount
+			result.CompletionTokens = res.EvalCount
+			result.Duration = res.TotalDuration
+		}
+		if onChunk != nil && res.Message.Content != "" {
+			return onChunk(res.Message.Content)
+		}
+		return nil
+	})
+	if err == nil {
+		err = ctx.Err() // a canceled stream can end without an error from the client
+	}
+	if err != nil {
+		return Completion{}, err
+	}
+	result.Answer = fullResponse.String()
+	return result, nil
+}
+
+// Generate sends the same conversation through /api/generate as one prompt,
+// the messages concatenated in order. Some base models follow a plain
+// prompt better than a chat template.
+func (p *OllamaProvider) Generate(ctx context.Context, model string, messages []api.Message, stream bool, onChunk func(string) error) (Completion, error) {
+	parts := make([]string, len(messages))
+	for i, msg := range messages {
+		parts[i] = msg.Content
+	}
+
+	var fullResponse strings.Builder
+	var result Completion
+	req := &api.GenerateRequest{
+		Model:  model,
+		Prompt: strings.Join(parts, "\n\n"),
+		Stream: &stream,
+	}
+
+	err := p.client.Generate(ctx, req, func(res api.GenerateResponse) error {
+		fullResponse.WriteString(res.Response)
+		if res.Done {
+			result.PromptTokens = res.PromptEvalCount
+			result.CompletionTokens = res.EvalCount
+			result.Duration = res.TotalDuration
+		}
+		if onChunk != nil && res.Response != "" {
+			return onChunk(res.Response)
+		}
+		return nil
+	})
+	if err == nil {
+		err = ctx.Err() // a canceled stream can end without an error from the client
+	}
+	if err != nil {
+		return Completion{}, err
+	}
+	result.Answer = fullResponse.String()
+	return result, nil
+}
+
+// Embed runs one /api/embed request
+func (p *OllamaProvider) Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	res, err := p.client.Embed(ctx, &api.EmbedRequest{Model: model, Input: inputs})
+	if err != nil {
+		return nil, err
+	}
+	return res.Embeddings, nil
+}
+
+// Models lists the locally available models
+func (p *OllamaProvider) Models(ctx context.Context) ([]string, error) {
+	resp, err := p.client.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, model := range resp.Models {
+		models = append(models, model.Name)
+	}
+	return models, nil
+}
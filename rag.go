@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RAG_DIR holds per-repository state under the scan root
+const RAG_DIR = ".viber"
+
+// RAG_INDEX_FILE is the embeddings cache inside RAG_DIR
+const RAG_INDEX_FILE = "embeddings.json"
+
+// RAG_CHUNK_TOKENS is the target size of an embedded chunk, cut at line boundaries
+const RAG_CHUNK_TOKENS = 400
+
+// RAG_EMBED_BATCH is how many chunks go into one embeddings request
+const RAG_EMBED_BATCH = 32
+
+// RAG_TOP_K is how many chunks -rag sends per question by default
+const RAG_TOP_K = 8
+
+// Chunk is a run of lines of one file with its (unit length) embedding
+type Chunk struct {
+	Path      string    `json:"-"` // Filled from the Files key on load
+	StartLine int       `json:"start_line"`
+	EndLine   int       `json:"end_line"`
+	Text      string    `json:"text"`
+	Vector    []float32 `json:"vector"`
+}
+
+// IndexedFile is the cached state of one file: its chunks are reused while
+// size and modification time still match
+type IndexedFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Chunks  []Chunk   `json:"chunks"`
+}
+
+// RetrievalIndex is the -rag embeddings cache of a scan root, stored as JSON
+// in <root>/.viber/embeddings.json. A cache built with another embedding
+// model is discarded.
+type RetrievalIndex struct {
+	Model   string                  `json:"model"`
+	Updated time.Time               `json:"updated"`
+	Files   map[string]*IndexedFile `json:"files"` // Root-relative path -> chunks
+
+	path string
+}
+
+// LoadRetrievalIndex opens the cache for root. With reindex set, or when the
+// cache is missing, unreadable or from another model, it starts empty.
+func LoadRetrievalIndex(root string, model string, reindex bool) *RetrievalIndex {
+	ri := &RetrievalIndex{Model: model, Files: make(map[string]*IndexedFile), path: filepath.Join(root, RAG_DIR, RAG_INDEX_FILE)}
+	if reindex {
+		return ri
+	}
+	data, err := os.ReadFile(ri.path)
+	if err != nil {
+		return ri
+	}
+	var cached RetrievalIndex
+	if json.Unmarshal(data, &cached) != nil || cached.Model != model || cached.Files == nil {
+		return ri
+	}
+	for path, file := range cached.Files {
+		for i := range file.Chunks {
+			file.Chunks[i].Path = path
+		}
+	}
+	ri.Files = cached.Files
+	return ri
+}
+
+// Save writes the cache, creating RAG_DIR
+func (ri *RetrievalIndex) Save() error {
+	if err := os.MkdirAll(filepath.Dir(ri.path), 0755); err != nil {
+		return err
+	}
+	ri.Updated = time.Now()
+	data, err := json.Marshal(ri)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ri.path, data, 0644)
+}
+
+// Chunks returns the number of cached chunks
+func (ri *RetrievalIndex) Chunks() int {
+	n := 0
+	for _, file := range ri.Files {
+		n += len(file.Chunks)
+	}
+	return n
+}
+
+// chunkFile cuts content into chunks of about RAG_CHUNK_TOKENS, recording
+// the line range of each
+func chunkFile(path string, content string) []Chunk {
+	var chunks []Chunk
+	line := 1
+	for _, part := range SplitContent(content, RAG_CHUNK_TOKENS) {
+		lines := strings.Count(strings.TrimSuffix(part, "\n"), "\n") + 1
+		if strings.TrimSpace(part) != "" {
+			chunks = append(chunks, Chunk{Path: path, StartLine: line, EndLine: line + lines - 1, Text: strings.TrimSuffix(part, "\n")})
+		}
+		line += lines
+	}
+	return chunks
+}
+
+// fileStamp returns the size and modification time a cached file is checked
+// against; archive entries use their archive's
+func (s *FileScanner) fileStamp(path string) (int64, time.Time, error) {
+	abs := s.absPath(path)
+	if archive, _, ok := splitArchivePath(abs); ok {
+		abs = archive
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return info.Size(), info.ModTime(), nil
+}
+
+// Update brings the cache in line with index: files that are new or changed
+// are read (through -preprocess), chunked and embedded, files no longer
+// indexed are dropped. progress is called after every embeddings request.
+// Files embedded before an error are kept and saved.
+func (ri *RetrievalIndex) Update(ctx context.Context, scanner *FileScanner, embedder *Embedder, index []FileIndex, progress func(done, total int)) (int, error) {
+	indexed := make(map[string]bool, len(index))
+	var pending []*Chunk
+	fresh := make(map[string]*IndexedFile)
+	for _, idx := range index {
+		indexed[idx.Path] = true
+		size, modTime, err := scanner.fileStamp(idx.Path)
+		if err != nil {
+			continue
+		}
+		if cached, ok := ri.Files[idx.Path]; ok && cached.Size == size && cached.ModTime.Equal(modTime) {
+			continue
+		}
+		content, err := scanner.ReadFile(idx.Path)
+		if err != nil {
+			continue
+		}
+		file := &IndexedFile{Size: size, ModTime: modTime, Chunks: chunkFile(idx.Path, content)}
+		fresh[idx.Path] = file
+		for i := range file.Chunks {
+			pending = append(pending, &file.Chunks[i])
+		}
+	}
+	for path := range ri.Files {
+		if !indexed[path] {
+			delete(ri.Files, path)
+		}
+	}
+
+	var err error
+	for start := 0; start < len(pending) && err == nil; start += RAG_EMBED_BATCH {
+		batch := pending[start:min(start+RAG_EMBED_BATCH, len(pending))]
+		inputs := make([]string, len(batch))
+		for i, chunk := range batch {
+			inputs[i] = chunk.Path + "\n" + chunk.Text // the path is a strong hint of what a chunk is about
+		}
+		var vectors [][]float32
+		if vectors, err = embedder.vectors(ctx, inputs); err == nil {
+			for i, chunk := range batch {
+				chunk.Vector = normalize(vectors[i])
+			}
+			if progress != nil {
+				progress(start+len(batch), len(pending))
+			}
+		}
+	}
+
+	embedded := 0
+	for path, file := range fresh {
+		if !slices.ContainsFunc(file.Chunks, func(c Chunk) bool { return c.Vector == nil }) {
+			ri.Files[path] = file
+			embedded++
+		}
+	}
+	if err != nil && embedded == 0 {
+		return 0, err // keep the cache on disk as it was
+	}
+	if saveErr := ri.Save(); err == nil {
+		err = saveErr
+	}
+	return embedded, err
+}
+
+// Retrieve returns the k chunks closest to question, best first. Chunks of
+// files for which skip returns true are left out.
+func (ri *RetrievalIndex) Retrieve(ctx context.Context, embedder *Embedder, question string, k int, skip func(path string) bool) ([]Chunk, error) {
+	vectors, err := embedder.vectors(ctx, []string{question})
+	if err != nil {
+		return nil, err
+	}
+	query := normalize(vectors[0])
+
+	type scored struct {
+		chunk *Chunk
+		score float32
+	}
+	var candidates []scored
+	for path, file := range ri.Files {
+		if skip != nil && skip(path) {
+			continue
+		}
+		for i := range file.Chunks {
+			candidates = append(candidates, scored{&file.Chunks[i], dot(query, file.Chunks[i].Vector)})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	chunks := make([]Chunk, 0, min(k, len(candidates)))
+	for _, c := range candidates[:min(k, len(candidates))] {
+		chunks = append(chunks, *c.chunk)
+	}
+	return chunks, nil
+}
+
+// normalize scales v to unit length, so a dot product is the cosine similarity
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
+
+func dot(a []float32, b []float32) float32 {
+	var sum float32
+	for i := range min(len(a), len(b)) {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// updateRetrieval refreshes the -rag cache against the current index
+func (s *Session) updateRetrieval(ctx context.Context) error {
+	cached := len(s.rag.Files)
+	embedded, err := s.rag.Update(ctx, s.scanner, s.embedder, s.index, func(done, total int) {
+		fmt.Printf("\r\033[K\033[90m🧲 Embedding chunks %d/%d...\033[0m", done, total)
+	})
+	fmt.Print("\r\033[K")
+	if err != nil {
+		return err
+	}
+	if embedded > 0 {
+		fmt.Printf("\033[32m🧲 Embedded %d new or changed files (%d chunks cached for %d files with %s)\033[0m\n", embedded, s.rag.Chunks(), len(s.rag.Files), s.embedder.Model)
+	} else {
+		fmt.Printf("\033[32m🧲 Embeddings up to date (%d chunks for %d files with %s, %d files read from cache)\033[0m\n", s.rag.Chunks(), len(s.rag.Files), s.embedder.Model, cached)
+	}
+	return nil
+}
+
+// retrieveContext assembles the -rag context for a question: pinned files in
+// full, then the s.ragTopK closest chunks of the other files, ordered by file
+// and line. It returns the files involved, the chunks sent and what
+// -max-context kept of both.
+func (s *Session) retrieveContext(ctx context.Context, question string) ([]string, string, []Chunk, BudgetReport, error) {
+	chunks, err := s.rag.Retrieve(ctx, s.embedder, question, s.ragTopK, func(path string) bool {
+		return s.dropped[path] || slices.Contains(s.pinned, path)
+	})
+	if err != nil {
+		return nil, "", nil, BudgetReport{}, err
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		if chunks[i].Path != chunks[j].Path {
+			return chunks[i].Path < chunks[j].Path
+		}
+		return chunks[i].StartLine < chunks[j].StartLine
+	})
+
+	repoContext, _, _, budget := s.buildContext(ctx, s.pinned)
+	var blocks []FileContent
+	for _, chunk := range chunks {
+		blocks = append(blocks, FileContent{Path: chunkHeader(s.scanner, chunk), Content: chunk.Text})
+	}
+	remaining := s.scanner.MaxContext
+	if remaining > 0 {
+		remaining = max(remaining-EstimateTokens(repoContext), 0)
+	}
+	blocks, report := FitBudget(blocks, remaining, nil)
+	budget.Tokens += report.Tokens
+	budget.Dropped = append(budget.Dropped, report.Dropped...)
+	if budget.Truncated == "" {
+		budget.Truncated = report.Truncated
+	}
+	chunks = slices.DeleteFunc(chunks, func(chunk Chunk) bool {
+		return slices.Contains(report.Dropped, chunkHeader(s.scanner, chunk))
+	})
+
+	var builder strings.Builder
+	builder.WriteString(repoContext)
+	for _, block := range blocks {
+		builder.WriteString(formatFileBlock(block.Path, block.Content))
+	}
+
+	paths := budget.kept(slices.Clone(s.pinned))
+	for _, chunk := range chunks {
+		if !slices.Contains(paths, chunk.Path) {
+			paths = append(paths, chunk.Path)
+		}
+	}
+	return paths, builder.String(), chunks, budget, nil
+}
+
+// chunkHeader is the FILE header of a chunk in the context
+func chunkHeader(scanner *FileScanner, chunk Chunk) string {
+	return fmt.Sprintf("%s (lines %d-%d)", scanner.DisplayPath(chunk.Path), chunk.StartLine, chunk.EndLine)
+}
+
+// askRetrieved is AskQuestion with -rag: the closest chunks replace the
+// file selection round
+func (s *Session) askRetrieved(ctx context.Context, question string) error {
+	fmt.Println("\033[90m🧲 Retrieving relevant chunks...\033[0m")
+	paths, repoContext, chunks, report, err := s.retrieveContext(ctx, question)
+	if err != nil {
+		return err
+	}
+	if len(chunks) > 0 {
+		fmt.Println("\033[33m📄 Relevant Chunks Retrieved:\033[0m")
+		for _, chunk := range chunks {
+			fmt.Printf("   - %s:%d-%d\n", s.scanner.DisplayPath(chunk.Path), chunk.StartLine, chunk.EndLine)
+		}
+	} else {
+		fmt.Println("\033[33m📄 No chunks retrieved, using general context.\033[0m")
+	}
+	if len(s.pinned) > 0 {
+		fmt.Printf("\033[33m📌 Plus %d pinned files (/add)\033[0m\n", len(s.pinned))
+	}
+	s.lastBudget = report
+	printBudgetReport(report)
+	s.lastPaths = paths
+	fmt.Printf("\033[90m📦 %d chunks from %d files loaded into context, %s\033[0m\n", len(chunks), len(paths), formatContextTokens(EstimateTokens(repoContext), s.scanner.MaxContext))
+
+	fmt.Println("\033[90m🤖 Generating answer...\033[0m")
+	return s.ask(ctx, repoContext, question)
+}
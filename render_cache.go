@@ -0,0 +1,53 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// RENDER_CACHE_SIZE bounds how many rendered answers are kept for reprints
+const RENDER_CACHE_SIZE = 64
+
+// renderCache remembers terminal renders by raw Markdown, least recently
+// used first out. It is safe for concurrent use.
+type renderCache struct {
+	mu      sync.Mutex
+	order   *list.List // front = most recent; values are *renderEntry
+	entries map[string]*list.Element
+}
+
+type renderEntry struct {
+	markdown string
+	rendered string
+}
+
+func newRenderCache() *renderCache {
+	return &renderCache{order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *renderCache) get(markdown string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[markdown]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*renderEntry).rendered, true
+}
+
+func (c *renderCache) put(markdown string, rendered string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[markdown]; ok {
+		elem.Value.(*renderEntry).rendered = rendered
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[markdown] = c.order.PushFront(&renderEntry{markdown: markdown, rendered: rendered})
+	if c.order.Len() > RENDER_CACHE_SIZE {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*renderEntry).markdown)
+	}
+}
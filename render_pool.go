@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+// renderPool bounds concurrent renders (-render-workers). A glamour
+// renderer keeps state while rendering, so each render borrows one of its
+// own; they are created on demand, at most one per slot.
+type renderPool struct {
+	slots chan struct{}
+	style string // resolved once, so new renderers don't query the terminal again
+	wrap  int    // -wrap limit, MAX_WRAP_WIDTH by default
+
+	mu   sync.Mutex
+	idle []*glamour.TermRenderer
+}
+
+// newRenderPool allows workers concurrent renders, runtime.NumCPU() when
+// workers < 1
+func newRenderPool(workers int) *renderPool {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	return &renderPool{slots: make(chan struct{}, workers), style: autoStyle(), wrap: MAX_WRAP_WIDTH}
+}
+
+// autoStyle makes the choice glamour.WithAutoStyle makes: notty when stdout
+// isn't a terminal, otherwise dark or light from the background color
+func autoStyle() string {
+	switch {
+	case !term.IsTerminal(int(os.Stdout.Fd())):
+		return styles.NoTTYStyle
+	case termenv.HasDarkBackground():
+		return styles.DarkStyle
+	default:
+		return styles.LightStyle
+	}
+}
+
+// render renders markdown with glamour once a slot is free
+func (p *renderPool) render(markdown string) (string, error) {
+	release := p.acquire()
+	defer release()
+
+	p.mu.Lock()
+	var r *glamour.TermRenderer
+	if n := len(p.idle); n > 0 {
+		r, p.idle = p.idle[n-1], p.idle[:n-1]
+	}
+	p.mu.Unlock()
+	if r == nil {
+		var err error
+		if r, err = glamour.NewTermRenderer(glamour.WithStandardStyle(p.style), glamour.WithWordWrap(wrapWidth(p.wrap))); err != nil {
+			return "", err
+		}
+	}
+
+	out, err := r.Render(markdown)
+	p.mu.Lock()
+	p.idle = append(p.idle, r)
+	p.mu.Unlock()
+	return out, err
+}
+
+// SetRenderWorkers changes how many renders may run at once (-render-workers);
+// call it before the first render
+func (ai *AIClient) SetRenderWorkers(workers int) {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	ai.renders.slots = make(chan struct{}, workers)
+}
+
+// SetWrapWidth changes the widest rendered line (-wrap); call it before the
+// first render
+func (ai *AIClient) SetWrapWidth(width int) {
+	if width > 0 {
+		ai.renders.wrap = max(width, MIN_WRAP_WIDTH)
+	}
+}
+
+// acquire waits for a free render slot and returns its release
+func (p *renderPool) acquire() func() {
+	p.slots <- struct{}{}
+	return func() { <-p.slots }
+}
+
+// renderAll renders every answer, up to the pool's worker count at a time,
+// and returns them in order
+func (ai *AIClient) renderAll(answers []string) []string {
+	rendered := make([]string, len(answers))
+	var wg sync.WaitGroup
+	for i, answer := range answers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rendered[i] = ai.render(answer)
+		}()
+	}
+	wg.Wait()
+	return rendered
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Review output formats (-review, -review-json)
+const (
+	REVIEW_TEXT = "text"
+	REVIEW_JSON = "json"
+)
+
+// REVIEW_NO_ISSUES is the whole answer when there is nothing to comment on
+const REVIEW_NO_ISSUES = "NO ISSUES"
+
+// REVIEW_SYSTEM_PROMPT replaces SYSTEM_PROMPT in review mode
+const REVIEW_SYSTEM_PROMPT = "You are a Senior Software Engineer reviewing code. Use the provided codebase (and the git diff, when present, which is what to review) to answer. " +
+	"Reply ONLY with review comments, one per line, in the form `path:line: severity: comment`, where path is the file path as shown in the FILE or diff headers, line is a line number in that file " +
+	"and severity is one of error, warning or suggestion. No headings, prose or code blocks. If there is nothing to comment on, reply with exactly " + REVIEW_NO_ISSUES + "."
+
+// REVIEW_REMINDER replaces SYSTEM_REMINDER in review mode
+const REVIEW_REMINDER = "Reminder: reply only with `path:line: severity: comment` lines (severity error, warning or suggestion), or " + REVIEW_NO_ISSUES + "."
+
+// reviewLine matches one comment, tolerating list markers, backticks and
+// bold around the location and bold or brackets around the severity
+var reviewLine = regexp.MustCompile("(?m)^\\s*(?:[-*•]|\\d+\\.)?\\s*[*`]*([^\\s*`:]+):(\\d+)[*`]*\\s*[:—–-]?\\s*[*\\[]*([A-Za-z]+)[*\\]]*\\s*[:—–-]\\s*(.+?)\\s*$")
+
+// reviewNoIssues matches an answer with nothing to report
+var reviewNoIssues = regexp.MustCompile(`(?mi)^\s*` + REVIEW_NO_ISSUES + `\b`)
+
+// reviewSeverities maps the words models use to the three normalized severities
+var reviewSeverities = map[string]string{
+	"error": "error", "critical": "error", "high": "error", "bug": "error",
+	"warning": "warning", "warn": "warning", "medium": "warning",
+	"suggestion": "suggestion", "low": "suggestion", "info": "suggestion", "nit": "suggestion", "style": "suggestion",
+}
+
+var reviewIcons = map[string]string{"error": "🔴", "warning": "🟡", "suggestion": "🔵"}
+
+// ReviewComment is one normalized review comment
+type ReviewComment struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Comment  string `json:"comment"`
+}
+
+// reviewValidator rejects answers with neither a comment nor REVIEW_NO_ISSUES,
+// so malformed reviews are asked again
+func reviewValidator(retries int) *AnswerValidator {
+	return &AnswerValidator{
+		Pattern: regexp.MustCompile(reviewLine.String() + "|" + reviewNoIssues.String()),
+		Retries: retries,
+	}
+}
+
+// ParseReview extracts the review comments from an answer, skipping lines
+// that aren't comments or have an unknown severity
+func ParseReview(answer string) []ReviewComment {
+	var comments []ReviewComment
+	for _, m := range reviewLine.FindAllStringSubmatch(answer, -1) {
+		severity, ok := reviewSeverities[strings.ToLower(m[3])]
+		if !ok {
+			continue
+		}
+		line, _ := strconv.Atoi(m[2])
+		comments = append(comments, ReviewComment{
+			File:     strings.TrimPrefix(m[1], "./"),
+			Line:     line,
+			Severity: severity,
+			Comment:  m[4],
+		})
+	}
+	return comments
+}
+
+// printReview prints the comments of a review answer as file:line lines or
+// as a JSON array. Answers without any comment are shown as they came, with
+// a warning unless they report REVIEW_NO_ISSUES.
+func (ai *AIClient) printReview(answer string) {
+	comments := ParseReview(answer)
+	if ai.Review == REVIEW_JSON {
+		if comments == nil {
+			comments = []ReviewComment{}
+		}
+		data, _ := json.MarshalIndent(comments, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	if len(comments) == 0 {
+		if reviewNoIssues.MatchString(answer) {
+			fmt.Println("\033[32m✅ No review comments\033[0m")
+			return
+		}
+		fmt.Println("\033[33m⚠️  No review comments found in the answer:\033[0m")
+		fmt.Println(ai.render(answer))
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, c := range comments {
+		counts[c.Severity]++
+		fmt.Printf("%s %s:%d \033[90m[%s]\033[0m %s\n", reviewIcons[c.Severity], c.File, c.Line, c.Severity, c.Comment)
+	}
+	fmt.Printf("\033[36m📝 %d review comments (%d errors, %d warnings, %d suggestions)\033[0m\n",
+		len(comments), counts["error"], counts["warning"], counts["suggestion"])
+}
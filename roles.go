@@ -0,0 +1,107 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var migrationName = regexp.MustCompile(`^\d+[_-]`)
+
+// goMain matches the entrypoint of a main package
+var goMain = regexp.MustCompile(`(?m)^func main\(\) \{`)
+
+// generatedMarker is the standard "Code generated ... DO NOT EDIT." line
+var generatedMarker = regexp.MustCompile(`(?m)^(//|#|--) Code generated .* DO NOT EDIT\.$`)
+
+// ClassifyFile guesses the structural role of a file from its path, name and
+// content, e.g. "Svelte component", "SQL migration" or "Go test". It
+// returns "" when nothing specific can be said.
+func ClassifyFile(path string, content string) string {
+	slashed := filepath.ToSlash(strings.ToLower(path))
+	name := filepath.Base(slashed)
+	ext := filepath.Ext(name)
+
+	if generatedMarker.MatchString(content) {
+		return "generated code"
+	}
+
+	switch {
+	case name == "justfile":
+		return "task runner recipes"
+	case name == "dockerfile" || strings.HasPrefix(name, "dockerfile."):
+		return "Dockerfile"
+	}
+
+	switch ext {
+	case ".go":
+		switch {
+		case strings.HasSuffix(name, "_test.go"):
+			return "Go test"
+		case goMain.MatchString(content):
+			return "Go entrypoint"
+		default:
+			return "Go source"
+		}
+	case ".svelte":
+		switch {
+		case strings.HasPrefix(name, "+page"):
+			return "SvelteKit page"
+		case strings.HasPrefix(name, "+layout"):
+			return "SvelteKit layout"
+		case strings.HasPrefix(name, "+error"):
+			return "SvelteKit error page"
+		default:
+			return "Svelte component"
+		}
+	case ".ts":
+		switch {
+		case strings.HasSuffix(name, ".test.ts") || strings.HasSuffix(name, ".spec.ts"):
+			return "TypeScript test"
+		case strings.HasSuffix(name, ".d.ts"):
+			return "TypeScript declarations"
+		case name == "+server.ts":
+			return "SvelteKit endpoint"
+		case strings.HasPrefix(name, "+page") || strings.HasPrefix(name, "+layout"):
+			return "SvelteKit load function"
+		default:
+			return "TypeScript module"
+		}
+	case ".sql":
+		if strings.Contains(slashed, "migration") || migrationName.MatchString(name) {
+			return "SQL migration"
+		}
+		return "SQL"
+	case ".yml", ".yaml":
+		switch {
+		case strings.Contains(slashed, ".github/workflows/"):
+			return "CI workflow"
+		case strings.HasPrefix(name, "docker-compose") || strings.HasPrefix(name, "compose."):
+			return "Docker Compose file"
+		default:
+			return "YAML config"
+		}
+	case ".rs":
+		switch {
+		case strings.Contains(slashed, "/tests/") || strings.HasPrefix(slashed, "tests/"):
+			return "Rust test"
+		case name == "main.rs":
+			return "Rust entrypoint"
+		case name == "lib.rs":
+			return "Rust crate root"
+		default:
+			return "Rust module"
+		}
+	case ".html":
+		return "HTML template"
+	}
+	return ""
+}
+
+// blockHeader is the FILE header for a path, with its role when annotating
+func blockHeader(path string, role string) string {
+	if role == "" {
+		return path
+	}
+	return path + " (" + role + ")"
+}
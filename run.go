@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// RUN_TIMEOUT bounds a /run command; it is killed when the time is up
+const RUN_TIMEOUT = 2 * time.Minute
+
+// RUN_MAX_OUTPUT is how much /run output is kept, from the end, where test
+// failures and stack traces usually are
+const RUN_MAX_OUTPUT = 32 * 1024
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	max     int
+	buf     []byte
+	dropped int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.max; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+		t.dropped += over
+	}
+	return len(p), nil
+}
+
+// CommandRun is the captured result of a /run command
+type CommandRun struct {
+	Command  string
+	Output   string // stdout and stderr interleaved, the last RUN_MAX_OUTPUT bytes
+	Dropped  int    // Bytes cut from the start of Output
+	ExitCode int    // -1 when the command couldn't start or was killed
+	TimedOut bool
+}
+
+// RunCommand runs command with sh in dir and captures its output
+func RunCommand(dir string, command string) CommandRun {
+	ctx, cancel := context.WithTimeout(context.Background(), RUN_TIMEOUT)
+	defer cancel()
+
+	out := &tailBuffer{max: RUN_MAX_OUTPUT}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = time.Second // don't wait on background children holding the pipes
+
+	run := CommandRun{Command: command, ExitCode: -1}
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		run.ExitCode = 0
+	case ctx.Err() != nil:
+		run.TimedOut = true
+	case errors.As(err, &exitErr):
+		run.ExitCode = exitErr.ExitCode()
+	default:
+		fmt.Fprintf(out, "%v\n", err)
+	}
+	run.Output = string(out.buf)
+	run.Dropped = out.dropped
+	return run
+}
+
+// status describes how the command ended
+func (r CommandRun) status() string {
+	switch {
+	case r.TimedOut:
+		return fmt.Sprintf("killed after %s", RUN_TIMEOUT)
+	case r.ExitCode < 0:
+		return "failed to start"
+	default:
+		return fmt.Sprintf("exit %d", r.ExitCode)
+	}
+}
+
+// block is the output as attached to the next question
+func (r CommandRun) block() string {
+	output := r.Output
+	if r.Dropped > 0 {
+		output = fmt.Sprintf("[... %d earlier bytes cut]\n%s", r.Dropped, output)
+	}
+	return fmt.Sprintf("\n--- COMMAND OUTPUT: $ %s (%s) ---\n%s\n", r.Command, r.status(), strings.TrimRight(output, "\n"))
+}
+
+// runCommand executes a /run command in the scan root, shows its output and
+// attaches it to the next question
+func (s *Session) runCommand(command string) {
+	if s.noRun {
+		fmt.Println("\033[33m⚠️  /run is disabled in this session (-no-run)\033[0m")
+		return
+	}
+	if command == "" {
+		fmt.Println("\033[31m❌ Usage: /run <command>\033[0m")
+		return
+	}
+
+	fmt.Printf("\033[33m⚠️  Running with your shell and permissions in %s (timeout %s):\033[0m\n", s.scanner.Root, RUN_TIMEOUT)
+	fmt.Printf("   \033[90m$ %s\033[0m\n", command)
+	run := RunCommand(s.scanner.Root, command)
+	if run.Output != "" {
+		fmt.Println(strings.TrimRight(run.Output, "\n"))
+	}
+
+	s.attached = append(s.attached, run.block())
+	note := ""
+	if run.Dropped > 0 {
+		note = fmt.Sprintf(", only the last %d KB kept", RUN_MAX_OUTPUT/1024)
+	}
+	fmt.Printf("\033[32m📎 Output attached to the next question (%s%s)\033[0m\n", run.status(), note)
+}
+
+// withAttachments prefixes the question with the /run output staged for it
+// and clears the stage
+func (s *Session) withAttachments(question string) string {
+	if len(s.attached) == 0 {
+		return question
+	}
+	prompt := strings.Join(s.attached, "") + "\n" + question
+	s.attached = nil
+	return prompt
+}
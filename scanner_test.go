@@ -0,0 +1,430 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree creates files (root-relative path -> content) under a temp dir
+// and returns the dir
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for path, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// scanPaths runs Scan and returns the sorted paths it read
+func scanPaths(t *testing.T, s *FileScanner) []string {
+	t.Helper()
+	files, err := s.Scan(2)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	paths := make([]string, 0, len(files))
+	for _, fc := range files {
+		paths = append(paths, filepath.ToSlash(fc.Path))
+	}
+	return paths
+}
+
+// fixtureTree has nested dirs, built-in and .gitignore'd dirs, an ignored
+// pattern, a binary file, an empty file and a disallowed extension
+var fixtureTree = map[string]string{
+	".gitignore":            "ignored/\n*.gen.go\n",
+	"main.go":               "package main\n",
+	"pkg/util.go":           "package pkg\n",
+	"pkg/deep/nested/x.ts":  "export const x = 1\n",
+	"pkg/api.gen.go":        "package pkg\n",
+	"ignored/skip.go":       "package ignored\n",
+	"node_modules/lib/a.ts": "export {}\n",
+	"vendor/dep/dep.go":     "package dep\n",
+	"blob.go":               "GIF89a\x00\x01\x02",
+	"empty.go":              "",
+	"notes.txt":             "not scanned\n",
+}
+
+func TestScanFixture(t *testing.T) {
+	root := writeTree(t, fixtureTree)
+	s, err := NewScanner(root, ".gitignore", []string{".go", ".ts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := scanPaths(t, s)
+	want := []string{"main.go", "pkg/deep/nested/x.ts", "pkg/util.go"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Scan = %q, want %q", got, want)
+	}
+	if s.Stats.SkippedBinary != 1 {
+		t.Errorf("SkippedBinary = %d, want 1", s.Stats.SkippedBinary)
+	}
+	if s.Stats.SkippedEmpty != 1 {
+		t.Errorf("SkippedEmpty = %d, want 1", s.Stats.SkippedEmpty)
+	}
+}
+
+func TestScanFixtureIncludeEmpty(t *testing.T) {
+	root := writeTree(t, fixtureTree)
+	s, err := NewScanner(root, ".gitignore", []string{".go", ".ts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.IncludeEmpty = true
+
+	got := scanPaths(t, s)
+	want := []string{"empty.go", "main.go", "pkg/deep/nested/x.ts", "pkg/util.go"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Scan = %q, want %q", got, want)
+	}
+}
+
+func TestScanForAIMatchesScan(t *testing.T) {
+	root := writeTree(t, fixtureTree)
+	s, err := NewScanner(root, ".gitignore", []string{".go", ".ts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := make(chan string, len(fixtureTree))
+	if err := s.ScanForAI(4, func(fc FileContent) { paths <- filepath.ToSlash(fc.Path) }); err != nil {
+		t.Fatalf("ScanForAI: %v", err)
+	}
+	close(paths)
+	var got []string
+	for path := range paths {
+		got = append(got, path)
+	}
+	slices.Sort(got)
+	if want := scanPaths(t, s); !slices.Equal(got, want) {
+		t.Errorf("ScanForAI = %q, Scan = %q", got, want)
+	}
+}
+
+func TestScanSymlinkLoop(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"a/file.go":   "package a\n",
+		"b/other.go":  "package b\n",
+		"lib/real.go": "package lib\n",
+	})
+	for link, target := range map[string]string{
+		"a/loop":     "..",                     // back to the root
+		"a/self":     ".",                      // its own directory
+		"b/sibling":  filepath.Join("..", "a"), // elsewhere in the tree, not a loop
+		"b/twin":     filepath.Join("..", "a"), // a second link to the same directory
+		"a/link.go":  filepath.Join("..", "lib", "real.go"),
+		"b/again.go": filepath.Join("..", "lib", "real.go"), // a second link to the same file
+		"a/dead.go":  "missing.go",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("symlinks unsupported: %v", err)
+		}
+	}
+	s, err := NewScanner(root, ".gitignore", []string{".go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []string)
+	go func() { done <- scanPaths(t, s) }()
+	var got []string
+	select {
+	case got = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("scan did not terminate")
+	}
+
+	want := []string{"a/file.go", "a/link.go", "b/other.go", "lib/real.go"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Scan = %q, want %q", got, want)
+	}
+	loops := slices.Clone(s.Stats.SymlinkLoops)
+	slices.Sort(loops)
+	if want := []string{"a/loop", "a/self"}; !slices.Equal(loops, want) {
+		t.Errorf("SymlinkLoops = %q, want %q", loops, want)
+	}
+	if want := []string{"b/again.go"}; !slices.Equal(s.Stats.SymlinkRepeats, want) {
+		t.Errorf("SymlinkRepeats = %q, want %q", s.Stats.SymlinkRepeats, want)
+	}
+}
+
+// captureStdout returns what fn prints to os.Stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-out
+}
+
+func TestPrintScanStatsSymlinkTarget(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		relative bool
+	}{
+		{"absolute dir", false},
+		{"relative dir", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeTree(t, map[string]string{"a/file.go": "package a\n"})
+			if err := os.Symlink("..", filepath.Join(root, "a", "loop")); err != nil {
+				t.Skipf("symlinks unsupported: %v", err)
+			}
+			dir := root
+			if tc.relative {
+				t.Chdir(filepath.Dir(root))
+				dir = filepath.Base(root)
+			}
+			s, err := NewScanner(dir, ".gitignore", []string{".go"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			scanPaths(t, s)
+
+			out := StripANSI(captureStdout(t, func() { printScanStats(s.Stats, s.Root, 0) }))
+			real, err := filepath.EvalSymlinks(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			link := filepath.Join("a", "loop")
+			if want := "Symlink loop: " + link + " -> " + real + " (skipped)"; !strings.Contains(out, want) {
+				t.Errorf("printScanStats = %q, want it to contain %q", out, want)
+			}
+		})
+	}
+}
+
+func TestScanCaseCollisions(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"src/Foo.ts": "export const a = 1\n",
+		"src/foo.ts": "export const b = 2\n",
+		"src/bar.ts": "export const c = 3\n",
+	})
+	if _, err := os.Stat(filepath.Join(root, "src", "FOO.ts")); err == nil {
+		t.Skip("case-insensitive filesystem")
+	}
+
+	for _, tc := range []struct {
+		name   string
+		dedupe bool
+		want   []string
+	}{
+		{"kept", false, []string{"src/Foo.ts", "src/bar.ts", "src/foo.ts"}},
+		{"deduped", true, []string{"src/Foo.ts", "src/bar.ts"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := NewScanner(root, ".gitignore", []string{".ts"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.DedupeCase = tc.dedupe
+
+			if got := scanPaths(t, s); !slices.Equal(got, tc.want) {
+				t.Errorf("Scan = %q, want %q", got, tc.want)
+			}
+			want := [][2]string{{filepath.Join("src", "Foo.ts"), filepath.Join("src", "foo.ts")}}
+			if !slices.Equal(s.Stats.CaseCollisions, want) {
+				t.Errorf("CaseCollisions = %q, want %q", s.Stats.CaseCollisions, want)
+			}
+		})
+	}
+}
+
+func TestScanGitignoreOutsideWorkingDir(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore":      "generated/\nsecret.go\n",
+		"main.go":         "package main\n",
+		"secret.go":       "package main\n",
+		"generated/x.go":  "package generated\n",
+		"pkg/keep/one.go": "package keep\n",
+	})
+	// A .gitignore in the working directory must not apply to -dir
+	cwd := writeTree(t, map[string]string{".gitignore": "main.go\n"})
+	t.Chdir(cwd)
+
+	rel, err := filepath.Rel(cwd, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{root, rel} {
+		s, err := NewScanner(dir, ".gitignore", []string{".go"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"main.go", "pkg/keep/one.go"}
+		if got := scanPaths(t, s); !slices.Equal(got, want) {
+			t.Errorf("Scan(%s) = %q, want %q", dir, got, want)
+		}
+	}
+}
+
+func TestScanExcludeDirGlobNested(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"main.go":                        "package main\n",
+		"generated/top.go":               "package generated\n",
+		"api/generated/client.go":        "package generated\n",
+		"api/v1/generated/deep/types.go": "package deep\n",
+		"api/v1/handler.go":              "package v1\n",
+		"packages/web/dist/bundle.ts":    "export {}\n",
+		"packages/web/src/app.ts":        "export {}\n",
+		"packages/web/nested/dist/x.ts":  "export {}\n",
+		"dist/top.ts":                    "export {}\n",
+	})
+	s, err := NewScanner(root, ".gitignore", []string{".go", ".ts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ExcludeDirs = []string{"**/generated", "packages/*/dist"}
+	delete(s.IgnoredNames, "dist") // built in; the glob must do the work here
+
+	got := scanPaths(t, s)
+	want := []string{
+		"api/v1/handler.go",
+		"dist/top.ts",
+		"main.go",
+		"packages/web/nested/dist/x.ts",
+		"packages/web/src/app.ts",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Scan = %q, want %q", got, want)
+	}
+}
+
+func TestBuildIndexWorkers(t *testing.T) {
+	files := map[string]string{"blob.go": "\x00\x01"}
+	for i := range 50 {
+		files[fmt.Sprintf("pkg%d/file%02d.go", i%5, i)] = fmt.Sprintf("package pkg%d\n", i%5)
+	}
+	root := writeTree(t, files)
+
+	var want []string
+	for _, workers := range []int{1, 3, 16} {
+		s, err := NewScanner(root, ".gitignore", []string{".go"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Workers = workers
+		index, err := s.BuildIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paths := make([]string, len(index))
+		for i, idx := range index {
+			paths[i] = filepath.ToSlash(idx.Path)
+		}
+		if !slices.IsSorted(paths) || len(paths) != 50 {
+			t.Errorf("workers=%d: index = %q, want 50 files in walk order", workers, paths)
+		}
+		if s.Stats.SkippedBinary != 1 {
+			t.Errorf("workers=%d: SkippedBinary = %d, want 1", workers, s.Stats.SkippedBinary)
+		}
+		if want == nil {
+			want = paths
+		} else if !slices.Equal(paths, want) {
+			t.Errorf("workers=%d: index differs from one worker", workers)
+		}
+	}
+}
+
+// BenchmarkScanForAI reads a tree of 2000 small files with several path
+// buffer sizes (-scan-buffer); 0 is the default of 16 per worker
+func BenchmarkScanForAI(b *testing.B) {
+	root := b.TempDir()
+	for i := range 2000 {
+		dir := filepath.Join(root, fmt.Sprintf("pkg%02d", i%40))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		content := fmt.Sprintf("package pkg%02d\n\n%s", i%40, strings.Repeat("// line of source\n", 50))
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%04d.go", i)), []byte(content), 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, size := range []int{0, 1, 8, 64, 512, 4096} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			for b.Loop() {
+				s, err := NewScanner(root, ".gitignore", []string{".go"})
+				if err != nil {
+					b.Fatal(err)
+				}
+				s.BufferSize = size
+				if err := s.ScanForAI(s.workerCount(), func(FileContent) {}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestMainMissingRootExits runs main in a child test process, which sees
+// VIBER_TEST_MAIN and parses the arguments after "--" as viber flags
+func TestMainMissingRootExits(t *testing.T) {
+	if os.Getenv("VIBER_TEST_MAIN") == "1" {
+		args := os.Args[slices.Index(os.Args, "--")+1:]
+		os.Args = append([]string{"viber"}, args...)
+		main()
+		return
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMainMissingRootExits$", "--", "-dir", missing)
+	cmd.Dir = t.TempDir()
+	cmd.Env = append(os.Environ(), "VIBER_TEST_MAIN=1", "HOME="+t.TempDir(), "OLLAMA_HOST=127.0.0.1:1")
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("viber -dir %s: err = %v, want exit status 1\n%s", missing, err, output)
+	}
+	if !strings.Contains(string(output), "cannot scan root directory") {
+		t.Errorf("no scan root error in output:\n%s", output)
+	}
+}
+
+func TestAddSkipsOversizedFile(t *testing.T) {
+	session := newTestSession(t, map[string]string{
+		"a.go":      "package main\n",
+		"small.bin": "tiny\n",
+		"big.bin":   "",
+	}, &mockProvider{})
+	if err := os.Truncate(filepath.Join(session.scanner.Root, "big.bin"), MAX_SANE_FILE_SIZE+1); err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(t, func() { session.addToContext("*.bin") })
+	if !slices.Equal(session.pinned, []string{"small.bin"}) {
+		t.Errorf("pinned %v, want [small.bin]", session.pinned)
+	}
+	if !strings.Contains(output, "big.bin skipped (too large") {
+		t.Errorf("no size warning for big.bin in:\n%s", output)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MAX_REQUEST_BODY bounds the JSON bodies accepted by the server
+const MAX_REQUEST_BODY = 1 << 20
+
+// Server exposes a scanned session over a small JSON API:
+//
+//	POST /ask        {"question": "..."} -> {"answer", "model", "files", "duration_ms"}
+//	POST /ask/stream {"question": "..."} -> Server-Sent Events (also GET ?question=)
+//	POST /rescan     rebuilds the index    -> {"files"}
+//	GET  /health                        -> {"status", "model", "files"}
+//
+// With an Embedder, /ask responses and the "done" event also carry
+// "embeddings" (or "embedding_error" when that request failed).
+type Server struct {
+	session    *Session
+	mu         sync.RWMutex // asks read the index, rescans replace it
+	PrettyJSON bool         // Indent JSON responses (SSE data always stays on one line)
+	Embedder   *Embedder    // -embed, nil = no embeddings
+}
+
+func NewServer(session *Session) *Server {
+	return &Server{session: session}
+}
+
+type askRequest struct {
+	Question string `json:"question"`
+}
+
+type askResponse struct {
+	Answer     string   `json:"answer"`
+	Model      string   `json:"model"`
+	Files      []string `json:"files"`
+	DurationMs int64    `json:"duration_ms"`
+	CostUSD    *float64 `json:"cost_usd,omitempty"` // Set when -price is given
+
+	Embeddings     *Embeddings `json:"embeddings,omitempty"` // Set with -embed
+	EmbeddingError string      `json:"embedding_error,omitempty"`
+}
+
+// embed computes the -embed vectors for an exchange. A failure doesn't fail
+// the request: the answer is still returned, with the error message.
+func (srv *Server) embed(r *http.Request, question string, answer string) (*Embeddings, string) {
+	if srv.Embedder == nil {
+		return nil, ""
+	}
+	embeddings, err := srv.Embedder.Embed(r.Context(), question, answer)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return embeddings, ""
+}
+
+// cost estimates a completion's price, or nil without -price
+func (srv *Server) cost(completion Completion) *float64 {
+	if srv.session.pricing == nil {
+		return nil
+	}
+	cost := srv.session.pricing.Cost(completion.PromptTokens, completion.CompletionTokens)
+	return &cost
+}
+
+// Handler returns the HTTP routes of the API
+func (srv *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /ask", srv.handleAsk)
+	mux.HandleFunc("POST /ask/stream", srv.handleAskStream)
+	mux.HandleFunc("GET /ask/stream", srv.handleAskStream)
+	mux.HandleFunc("POST /rescan", srv.handleRescan)
+	mux.HandleFunc("GET /health", srv.handleHealth)
+	return traced(mux)
+}
+
+// traced starts a span per request so the scan, assembly and chat spans of
+// a question nest under the HTTP call that asked it
+func traced(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), r.Method+" "+r.URL.Path, trace.WithAttributes(
+			attribute.String("http.method", r.Method),
+			attribute.String("http.path", r.URL.Path),
+		))
+		defer span.End()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ListenAndServe serves the API on addr until the listener fails
+func (srv *Server) ListenAndServe(addr string) error {
+	fmt.Printf("\033[36m🌐 Serving on %s (POST /ask, /ask/stream, POST /rescan, GET /health)\033[0m\n", addr)
+	return http.ListenAndServe(addr, srv.Handler())
+}
+
+func (srv *Server) handleAsk(w http.ResponseWriter, r *http.Request) {
+	question, err := readQuestion(w, r)
+	if err != nil {
+		srv.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	start := time.Now()
+	paths, repoContext, err := srv.selectContext(r, question)
+	if err != nil {
+		srv.writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	completion, err := srv.session.ai.Complete(r.Context(), repoContext, question)
+	if err != nil {
+		srv.writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	response := askResponse{
+		Answer:     completion.Answer,
+		Model:      srv.session.ai.Model(),
+		Files:      paths,
+		DurationMs: time.Since(start).Milliseconds(),
+		CostUSD:    srv.cost(completion),
+	}
+	response.Embeddings, response.EmbeddingError = srv.embed(r, question, completion.Answer)
+	srv.writeJSON(w, http.StatusOK, response)
+}
+
+// handleAskStream streams the answer as Server-Sent Events: one "files"
+// event, a "token" event per chunk, then "done" with usage metadata (or
+// "error"). A client disconnect cancels the upstream chat request.
+func (srv *Server) handleAskStream(w http.ResponseWriter, r *http.Request) {
+	question := strings.TrimSpace(r.URL.Query().Get("question"))
+	if r.Method == http.MethodPost {
+		var err error
+		if question, err = readQuestion(w, r); err != nil {
+			srv.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if question == "" {
+		srv.writeError(w, http.StatusBadRequest, errors.New("question is required"))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		srv.writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	start := time.Now()
+	paths, repoContext, err := srv.selectContext(r, question)
+	if err != nil {
+		srv.writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event string, v any) error {
+		data, _ := json.Marshal(v)
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	if err := send("files", paths); err != nil {
+		return
+	}
+
+	completion, err := srv.session.ai.CompleteStream(r.Context(), repoContext, question, func(chunk string) error {
+		return send("token", map[string]string{"content": chunk})
+	})
+	if err != nil {
+		if r.Context().Err() == nil {
+			send("error", map[string]string{"error": err.Error()})
+		}
+		return
+	}
+
+	done := map[string]any{
+		"model":             srv.session.ai.Model(),
+		"files":             paths,
+		"prompt_tokens":     completion.PromptTokens,
+		"completion_tokens": completion.CompletionTokens,
+		"duration_ms":       time.Since(start).Milliseconds(),
+	}
+	if cost := srv.cost(completion); cost != nil {
+		done["cost_usd"] = *cost
+	}
+	if embeddings, embedErr := srv.embed(r, question, completion.Answer); embeddings != nil {
+		done["embeddings"] = embeddings
+	} else if embedErr != "" {
+		done["embedding_error"] = embedErr
+	}
+	send("done", done)
+}
+
+func (srv *Server) handleRescan(w http.ResponseWriter, r *http.Request) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	index, err := srv.session.scanner.BuildIndex()
+	if err != nil && index == nil {
+		srv.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	srv.session.index = index
+	srv.writeJSON(w, http.StatusOK, map[string]int{"files": len(index)})
+}
+
+func (srv *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	srv.mu.RLock()
+	files := len(srv.session.index)
+	srv.mu.RUnlock()
+
+	srv.writeJSON(w, http.StatusOK, map[string]any{
+		"status": "ok",
+		"model":  srv.session.ai.Model(),
+		"files":  files,
+	})
+}
+
+// selectContext assembles the context for a request under the read lock;
+// files is never nil so it encodes as a JSON array
+func (srv *Server) selectContext(r *http.Request, question string) ([]string, string, error) {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+
+	paths, repoContext, err := srv.session.selectContext(r.Context(), question)
+	if paths == nil {
+		paths = []string{}
+	}
+	return paths, repoContext, err
+}
+
+// readQuestion decodes the {"question": ...} body shared by the ask endpoints
+func readQuestion(w http.ResponseWriter, r *http.Request) (string, error) {
+	var req askRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_REQUEST_BODY)).Decode(&req); err != nil {
+		return "", fmt.Errorf("invalid request body: %w", err)
+	}
+	question := strings.TrimSpace(req.Question)
+	if question == "" {
+		return "", errors.New("question is required")
+	}
+	return question, nil
+}
+
+// writeJSON sends v as the response body: one compact line by default, which
+// suits pipes and log shippers, or indented when PrettyJSON is set
+func (srv *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	if srv.PrettyJSON {
+		enc.SetIndent("", "  ")
+	}
+	enc.Encode(v)
+}
+
+func (srv *Server) writeError(w http.ResponseWriter, status int, err error) {
+	srv.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
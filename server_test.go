@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+// mockProvider answers the file selection round with Select and every other
+// chat with an echo of the question. It is safe for concurrent use.
+type mockProvider struct {
+	Select []string
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *mockProvider) Name() string { return "mock" }
+
+func (p *mockProvider) Chat(ctx context.Context, model string, messages []api.Message, stream bool, onChunk func(string) error) (Completion, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+
+	if len(messages) > 0 && strings.Contains(messages[0].Content, "file selection engine") {
+		selection, _ := json.Marshal(p.Select)
+		return Completion{Answer: string(selection)}, nil
+	}
+	answer := "answer to: " + messages[len(messages)-1].Content
+	if stream && onChunk != nil {
+		if err := onChunk(answer); err != nil {
+			return Completion{}, err
+		}
+	}
+	return Completion{Answer: answer, PromptTokens: 10, CompletionTokens: 5}, nil
+}
+
+func (p *mockProvider) Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	vectors := make([][]float32, len(inputs))
+	for i := range inputs {
+		vectors[i] = []float32{1, 0}
+	}
+	return vectors, nil
+}
+
+func (p *mockProvider) Models(ctx context.Context) ([]string, error) {
+	return []string{"mock:latest"}, nil
+}
+
+// newTestSession scans files with a mock provider behind it
+func newTestSession(t *testing.T, files map[string]string, provider Provider) *Session {
+	t.Helper()
+	scanner, err := NewScanner(writeTree(t, files), ".gitignore", []string{".go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := scanner.BuildIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Session{scanner: scanner, index: index, ai: NewAIClient(provider, "mock:latest")}
+}
+
+func TestServerConcurrentAsks(t *testing.T) {
+	provider := &mockProvider{Select: []string{"small.go", "big.go"}}
+	session := newTestSession(t, map[string]string{
+		"small.go": "package main\n",
+		"big.go":   "package main\n\n" + strings.Repeat("// filler line for the budget\n", 400),
+	}, provider)
+	session.scanner.MaxContext = 200 // big.go doesn't fit
+
+	server := httptest.NewServer(NewServer(session).Handler())
+	defer server.Close()
+
+	const requests = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"question": "question %d"}`, i)
+			resp, err := http.Post(server.URL+"/ask", "application/json", strings.NewReader(body))
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer resp.Body.Close()
+
+			var answer askResponse
+			if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+				errs <- err
+				return
+			}
+			if resp.StatusCode != http.StatusOK {
+				errs <- fmt.Errorf("status %d", resp.StatusCode)
+				return
+			}
+			if want := fmt.Sprintf("question %d", i); !strings.HasSuffix(answer.Answer, want) {
+				errs <- fmt.Errorf("answer %q is not for %q", answer.Answer, want)
+			}
+			if len(answer.Files) != 1 || answer.Files[0] != "small.go" {
+				errs <- fmt.Errorf("files = %q, want only small.go", answer.Files)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if provider.calls != 2*requests {
+		t.Errorf("provider got %d calls, want %d", provider.calls, 2*requests)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SavedSession is a named session stored as JSON in
+// ~/.config/.ollama-interactive/sessions/<name>.json
+type SavedSession struct {
+	Repo    string    `json:"repo"`
+	Model   string    `json:"model"`
+	Updated time.Time `json:"updated"`
+	Turns   []Turn    `json:"turns"`
+}
+
+// SessionInfo is one row of -sessions
+type SessionInfo struct {
+	Name    string
+	Repo    string
+	Updated time.Time
+	Turns   int
+}
+
+var sessionName = regexp.MustCompile(`^[\w.-]+$`)
+
+// SessionsDir is where named sessions are kept
+func SessionsDir() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "sessions"), nil
+}
+
+// SessionPath maps a session name onto its file. Anything that looks like
+// a path (a separator or a .json suffix) is used as is.
+func SessionPath(name string) (string, error) {
+	if strings.ContainsRune(name, filepath.Separator) || strings.HasSuffix(name, ".json") {
+		return name, nil
+	}
+	if !sessionName.MatchString(name) || strings.Trim(name, ".") == "" {
+		return "", fmt.Errorf("invalid session name %q (use letters, digits, '.', '-' and '_')", name)
+	}
+	dir, err := SessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// LoadSession reads a saved session by name or path; a name never used before gives an
+// empty session
+func LoadSession(name string) (*SavedSession, error) {
+	path, err := SessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &SavedSession{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved SavedSession
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &saved, nil
+}
+
+// SaveSession writes a named session, creating the sessions directory
+func SaveSession(name string, saved *SavedSession) error {
+	path, err := SessionPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	saved.Updated = time.Now()
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ListSessions returns the saved sessions, most recently updated first.
+// Files that can't be parsed are skipped.
+func ListSessions() ([]SessionInfo, error) {
+	dir, err := SessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []SessionInfo
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		saved, err := LoadSession(name)
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, SessionInfo{Name: name, Repo: saved.Repo, Updated: saved.Updated, Turns: len(saved.Turns)})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Updated.After(sessions[j].Updated) })
+	return sessions, nil
+}
+
+// printSessions is the -sessions listing
+func printSessions() error {
+	sessions, err := ListSessions()
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		fmt.Println("\033[90mNo saved sessions yet (start one with -session <name>)\033[0m")
+		return nil
+	}
+
+	fmt.Println("\033[36m🗂️  Saved sessions:\033[0m")
+	for _, info := range sessions {
+		fmt.Printf("   \033[1m%-20s\033[0m %3d turns  \033[90m%s  %s\033[0m\n",
+			info.Name, info.Turns, info.Updated.Local().Format("2006-01-02 15:04"), info.Repo)
+	}
+	return nil
+}
+
+// persist writes the transcript (-save) and the named session (-session)
+// after the turns changed
+func (s *Session) persist() {
+	if s.savePath != "" {
+		if err := SaveTranscript(s.savePath, s.turns); err != nil {
+			fmt.Printf("\033[33m⚠️  Could not save transcript: %v\033[0m\n", err)
+		}
+	}
+	if s.sessionName != "" {
+		saved := &SavedSession{Repo: s.scanner.Root, Model: s.ai.Model(), Turns: s.turns}
+		if abs, err := filepath.Abs(s.scanner.Root); err == nil {
+			saved.Repo = abs
+		}
+		if err := SaveSession(s.sessionName, saved); err != nil {
+			fmt.Printf("\033[33m⚠️  Could not save session %s: %v\033[0m\n", s.sessionName, err)
+		}
+	}
+}
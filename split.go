@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitContent cuts content into parts of roughly targetTokens each, breaking
+// only at line boundaries. A single line longer than the target stays whole.
+func SplitContent(content string, targetTokens int) []string {
+	if targetTokens <= 0 || EstimateTokens(content) <= targetTokens {
+		return []string{content}
+	}
+
+	var parts []string
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if current.Len() > 0 && EstimateTokens(current.String()+line) > targetTokens {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+// SplitFiles replaces every file bigger than targetTokens with its numbered
+// parts, so FitBudget can keep or drop them one at a time
+func SplitFiles(files []FileContent, targetTokens int) []FileContent {
+	if targetTokens <= 0 {
+		return files
+	}
+	result := make([]FileContent, 0, len(files))
+	for _, fc := range files {
+		parts := SplitContent(fc.Content, targetTokens)
+		if len(parts) == 1 {
+			result = append(result, fc)
+			continue
+		}
+		for i, part := range parts {
+			p := fc
+			p.Content = strings.TrimSuffix(part, "\n")
+			p.Part, p.Parts = i+1, len(parts)
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// label is the FILE header of fc under name: "name (part i/n)" for a part
+func (fc FileContent) label(name string) string {
+	if fc.Parts == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s (part %d/%d)", name, fc.Part, fc.Parts)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// streamPrinter renders a streamed Markdown answer one finished block at a
+// time: glamour needs whole blocks, so text is held back until a blank line
+// outside a code fence or a closing fence. Finish replaces the pieces with
+// one full render when they still fit on the screen.
+type streamPrinter struct {
+	ai      *AIClient
+	pending string // text not printed yet
+	scanned int    // bytes of pending already checked for boundaries
+	inFence bool   // scanned text ends inside a ``` or ~~~ block
+	lines   int    // terminal lines printed so far
+}
+
+// Write adds a chunk and prints every block it completes
+func (p *streamPrinter) Write(chunk string) {
+	p.pending += chunk
+	for {
+		nl := strings.IndexByte(p.pending[p.scanned:], '\n')
+		if nl < 0 {
+			return
+		}
+		line := strings.TrimSpace(p.pending[p.scanned : p.scanned+nl])
+		p.scanned += nl + 1
+
+		boundary := false
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			boundary = p.inFence // a closing fence ends the block
+			p.inFence = !p.inFence
+		} else if line == "" && !p.inFence {
+			boundary = true
+		}
+		if boundary {
+			p.print(p.pending[:p.scanned])
+			p.pending = p.pending[p.scanned:]
+			p.scanned = 0
+		}
+	}
+}
+
+func (p *streamPrinter) print(markdown string) {
+	if strings.TrimSpace(markdown) == "" {
+		return
+	}
+	out := p.ai.render(markdown)
+	if p.lines > 0 {
+		out = strings.TrimLeft(out, "\n") // glamour opens every render with a blank line
+	}
+	fmt.Print(out)
+	p.lines += strings.Count(out, "\n")
+}
+
+// Finish prints the rest of the answer. On a terminal where everything
+// printed so far is still visible, it is cleared and the whole answer is
+// rendered again so spacing and lists come out as in a buffered render.
+func (p *streamPrinter) Finish(answer string) {
+	if height := terminalHeight(); p.lines > 0 && p.lines < height {
+		fmt.Printf("\033[%dF\033[J", p.lines)
+		fmt.Println(p.ai.render(answer))
+		return
+	}
+	p.print(p.pending)
+	fmt.Println()
+}
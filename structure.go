@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StructureContext describes the repository without any file bodies: an
+// indented tree of the given files followed, per file, by its declaration
+// lines only. This is what -names-only sends instead of FILE blocks.
+func (s *FileScanner) StructureContext(paths []string) string {
+	rels := make([]string, 0, len(paths))
+	for _, path := range paths {
+		rels = append(rels, filepath.ToSlash(s.DisplayPath(path)))
+	}
+	sort.Strings(rels)
+
+	var b strings.Builder
+	b.WriteString("\n--- REPOSITORY TREE (names only, file contents withheld) ---\n")
+	var previous []string
+	for _, rel := range rels {
+		parts := strings.Split(rel, "/")
+		// Print only the directories that changed since the previous file
+		common := 0
+		for common < len(parts)-1 && common < len(previous)-1 && parts[common] == previous[common] {
+			common++
+		}
+		for depth := common; depth < len(parts)-1; depth++ {
+			fmt.Fprintf(&b, "%s%s/\n", strings.Repeat("  ", depth), parts[depth])
+		}
+		fmt.Fprintf(&b, "%s%s\n", strings.Repeat("  ", len(parts)-1), parts[len(parts)-1])
+		previous = parts
+	}
+
+	for _, path := range paths {
+		content, err := s.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if signatures := declarations(strings.Split(content, "\n"), 0); len(signatures) > 0 {
+			fmt.Fprintf(&b, "\n--- DECLARATIONS: %s ---\n%s\n", path, strings.Join(signatures, "\n"))
+		}
+	}
+	return b.String()
+}
+
+// indexPaths lists every indexed path, pinned files included
+func (s *Session) indexPaths() []string {
+	paths := make([]string, 0, len(s.index))
+	for _, idx := range s.index {
+		paths = append(paths, idx.Path)
+	}
+	return s.contextPaths(paths)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the scan, assembly and chat phases. It is a no-op until
+// SetupTracing installs a provider, so unconfigured runs pay nothing.
+var tracer = otel.Tracer("github.com/mar-cial/viber")
+
+// SetupTracing exports spans over OTLP/HTTP to endpoint, either host:port
+// (plain HTTP, e.g. a local collector on localhost:4318) or a full URL.
+// The returned function flushes pending spans and must run before exit.
+func SetupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	var opts []otlptracehttp.Option
+	if strings.Contains(endpoint, "://") {
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+	} else {
+		opts = append(opts, otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "viber"))),
+	)
+	otel.SetTracerProvider(provider)
+	tracer = provider.Tracer("github.com/mar-cial/viber")
+	return provider.Shutdown, nil
+}
+
+// endSpan records err (if any) on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const MAX_WRAP_WIDTH = 100
+const MAX_SEPARATOR_WIDTH = 60
+
+// MIN_WRAP_WIDTH keeps glamour usable even on absurdly narrow terminals
+const MIN_WRAP_WIDTH = 20
+
+// terminalWidth returns the width of stdout in columns, or 0 when stdout is
+// not a terminal
+func terminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// terminalHeight returns the height of stdout in rows, or 0 when stdout is
+// not a terminal
+func terminalHeight() int {
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return height
+}
+
+// wrapWidth is the glamour word-wrap width: limit columns (-wrap, 100 by
+// default), or less when the terminal is narrower (leaving room for
+// glamour's margins)
+func wrapWidth(limit int) int {
+	width := terminalWidth()
+	if width <= 0 {
+		return limit
+	}
+	return max(MIN_WRAP_WIDTH, min(limit, width-4))
+}
+
+// separator returns the dim rule printed around answers, never wider than the terminal
+func separator() string {
+	width := MAX_SEPARATOR_WIDTH
+	if tw := terminalWidth(); tw > 0 && tw < width {
+		width = tw
+	}
+	return "\033[90m" + strings.Repeat("─", width) + "\033[0m"
+}
+
+// stdinIsTerminal reports whether someone can answer prompts on stdin
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// stdoutIsTerminal reports whether answers are shown to someone rather than
+// piped to a file or another program
+func stdoutIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
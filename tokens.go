@@ -0,0 +1,10 @@
+package main
+
+// CHARS_PER_TOKEN is the rough ratio used to estimate token counts without a
+// tokenizer; close enough for source code on most models.
+const CHARS_PER_TOKEN = 4
+
+// EstimateTokens approximates how many tokens text costs in a prompt
+func EstimateTokens(text string) int {
+	return (len(text) + CHARS_PER_TOKEN - 1) / CHARS_PER_TOKEN
+}
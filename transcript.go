@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Turn is one question/answer exchange of the session
+type Turn struct {
+	Question string    `json:"question"`
+	Answer   string    `json:"answer"` // Raw Markdown as returned by the model
+	Time     time.Time `json:"time"`
+	Tags     []string  `json:"tags,omitempty"` // Categories set with /tag
+}
+
+// formatTags renders a turn's tags as a Markdown line, or "" when untagged
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "Tags: `" + strings.Join(tags, "` `") + "`\n\n"
+}
+
+// ansiPattern matches CSI sequences (colors, cursor moves) and OSC sequences
+// (titles, hyperlinks)
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)`)
+
+// StripANSI removes terminal escape sequences from s
+func StripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// SaveTranscript writes the whole session to path as Markdown. Answers are
+// stored raw (never the rendered terminal output) and stripped of any stray
+// escape sequences so the file stays valid Markdown.
+func SaveTranscript(path string, turns []Turn) error {
+	var b strings.Builder
+	b.WriteString("# VIBER Session\n")
+
+	for _, turn := range turns {
+		fmt.Fprintf(&b, "\n## %s\n\n", StripANSI(turn.Question))
+		fmt.Fprintf(&b, "_%s_\n\n", turn.Time.Format(time.RFC3339))
+		b.WriteString(formatTags(turn.Tags))
+		b.WriteString(strings.TrimSpace(StripANSI(turn.Answer)))
+		b.WriteString("\n\n---\n")
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// AppendAnswer appends one turn to an existing Markdown file (creating it and
+// its directory if needed), with the question as a heading and a separator
+// and timestamp between entries
+func AppendAnswer(path string, turn Turn) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		b.WriteString("\n---\n\n")
+	}
+	fmt.Fprintf(&b, "## %s\n\n", StripANSI(turn.Question))
+	fmt.Fprintf(&b, "_%s_\n\n", time.Now().Format(time.RFC3339))
+	b.WriteString(formatTags(turn.Tags))
+	b.WriteString(strings.TrimSpace(StripANSI(turn.Answer)))
+	b.WriteString("\n")
+
+	_, err = f.WriteString(b.String())
+	return err
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// leakyTurns have escape sequences in the question and around and inside
+// code blocks, as a render leaking into the stored answer would leave them
+var leakyTurns = []Turn{
+	{
+		Question: "\x1b[1mhow do I start it?\x1b[0m",
+		Answer:   "Run the server:\n\n```go\n\x1b[38;5;81mfunc\x1b[0m main() {}\n```\n\n\x1b]8;;https://go.dev\x07docs\x1b]8;;\x07",
+		Time:     time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags:     []string{"setup"},
+	},
+	{
+		Question: "and the script?",
+		Answer:   "~~~sh\n\x1b[32mecho\x1b[0m hi\n~~~",
+		Time:     time.Date(2026, 1, 2, 3, 5, 0, 0, time.UTC),
+	},
+}
+
+func TestSaveTranscriptStripsANSI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.md")
+	if err := SaveTranscript(path, leakyTurns); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+
+	if strings.Contains(got, "\x1b") {
+		t.Errorf("transcript has escape sequences:\n%q", got)
+	}
+	for _, want := range []string{
+		"## how do I start it?\n",
+		"```go\nfunc main() {}\n```",
+		"~~~sh\necho hi\n~~~",
+		"Tags: `setup`",
+		"docs",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("transcript is missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestAppendAnswerStripsANSI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes", "answers.md")
+	for _, turn := range leakyTurns {
+		if err := AppendAnswer(path, turn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+
+	if strings.Contains(got, "\x1b") {
+		t.Errorf("appended answers have escape sequences:\n%q", got)
+	}
+	if n := strings.Count(got, "\n---\n"); n != 1 {
+		t.Errorf("got %d separators, want 1:\n%s", n, got)
+	}
+	if !strings.Contains(got, "```go\nfunc main() {}\n```") {
+		t.Errorf("code block not kept verbatim:\n%s", got)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// AnswerValidator checks raw answers for structured-output tasks. An answer
+// that doesn't match Pattern is sent back to the model with the reason, up
+// to Retries more times.
+type AnswerValidator struct {
+	Pattern *regexp.Regexp
+	Retries int
+}
+
+// Check reports why answer is not acceptable, or nil if it is
+func (v *AnswerValidator) Check(answer string) error {
+	if !v.Pattern.MatchString(answer) {
+		return fmt.Errorf("answer does not match the required pattern %s", v.Pattern)
+	}
+	return nil
+}
+
+// retryQuestion re-asks the original question with the rejected answer and
+// the validation error appended
+func retryQuestion(question string, answer string, err error) string {
+	return fmt.Sprintf("%s\n\nYour previous answer was rejected: %v.\n\nPrevious answer:\n%s\n\nAnswer the original question again, in the required format.", question, err, answer)
+}
+
+// completeValidated asks the question in the ongoing conversation with the
+// spinner and, when a validator is set, retries until the answer passes. It
+// returns the last completion, the number of attempts used and
+// ErrValidationFailed if none passed.
+func (ai *AIClient) completeValidated(ctx context.Context, question string) (Completion, int, error) {
+	prompt := question
+	for attempt := 1; ; attempt++ {
+		done := make(chan bool)
+		go ai.playSpinner(ctx, done)
+		completion, err := ai.chat(ctx, ai.conversation(prompt), false, nil)
+		done <- true
+		if err != nil || ai.Validator == nil {
+			return completion, attempt, err
+		}
+
+		checkErr := ai.Validator.Check(completion.Answer)
+		if checkErr == nil {
+			return completion, attempt, nil
+		}
+		if attempt > ai.Validator.Retries {
+			return completion, attempt, fmt.Errorf("%w after %d attempts: %v", ErrValidationFailed, attempt, checkErr)
+		}
+		fmt.Printf("\033[33m⚠️  Attempt %d/%d failed validation, asking again\033[0m\n", attempt, ai.Validator.Retries+1)
+		prompt = retryQuestion(question, completion.Answer, checkErr)
+	}
+}